@@ -0,0 +1,178 @@
+package appmetrica_push
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Color is a color of Android notification fields. Use ARGB for IconBackground and RGB for LedColor,
+// or the setters of AndroidContent which pick the right format.
+type Color color.NRGBA
+
+// VibrationPattern is a vibration pattern: pause, vibration, pause, vibration and so on.
+// Durations are sent in milliseconds.
+type VibrationPattern []time.Duration
+
+// NewColor is a function to create Color from any color, e.g. color.RGBA{R: 0xff, A: 0xff}.
+// Alpha-premultiplied colors like color.RGBA are converted, so semi-transparent colors keep their hue.
+func NewColor(c color.Color) Color {
+	return Color(color.NRGBAModel.Convert(c).(color.NRGBA))
+}
+
+// ParseColor is a function to parse color in #RRGGBB or #AARRGGBB format. Colors without alpha are opaque.
+func ParseColor(s string) (Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 && len(hex) != 8 || !isHex(hex) {
+		return Color{}, fmt.Errorf("color %q should be #RRGGBB or #AARRGGBB", s)
+	}
+	v, _ := strconv.ParseUint(hex, 16, 32)
+	if len(hex) == 6 {
+		v |= 0xff000000
+	}
+	return Color{A: uint8(v >> 24), R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+}
+
+// ARGB is a method to format the color as #AARRGGBB, the format of AndroidContent.IconBackground
+func (c Color) ARGB() string {
+	return fmt.Sprintf("#%02X%02X%02X%02X", c.A, c.R, c.G, c.B)
+}
+
+// RGB is a method to format the color as #RRGGBB, the format of AndroidContent.LedColor. Alpha is dropped
+func (c Color) RGB() string {
+	return fmt.Sprintf("#%02X%02X%02X", c.R, c.G, c.B)
+}
+
+// NewVibrationPattern is a function to create the pattern from pause and vibration durations and validate it
+func NewVibrationPattern(durations ...time.Duration) (VibrationPattern, error) {
+	p := VibrationPattern(durations)
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate is a method to check that the pattern is not empty and durations are whole non-negative milliseconds,
+// since anything else is lost or rejected by the device
+func (p VibrationPattern) Validate() error {
+	if len(p) == 0 {
+		return errors.New("vibration pattern is empty")
+	}
+	vibrates := false
+	for i, d := range p {
+		if err := checkMillis(d); err != nil {
+			return fmt.Errorf("vibration pattern item %d: %w", i, err)
+		}
+		if i%2 == 1 && d > 0 {
+			vibrates = true
+		}
+	}
+	if !vibrates {
+		return errors.New("vibration pattern has no vibrations")
+	}
+	return nil
+}
+
+// Millis is a method to get the pattern in the format of AndroidContent.Vibration
+func (p VibrationPattern) Millis() []int {
+	ms := make([]int, len(p))
+	for i, d := range p {
+		ms[i] = int(d.Milliseconds())
+	}
+	return ms
+}
+
+// SetIconBackground is a method to set the color of the notification icon
+func (c *AndroidContent) SetIconBackground(color Color) {
+	c.IconBackground = color.ARGB()
+}
+
+// SetVibration is a method to validate the pattern and set it
+func (c *AndroidContent) SetVibration(p VibrationPattern) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	c.Vibration = p.Millis()
+	return nil
+}
+
+// LEDBlink is a method to set LED color and blinking intervals. The LED glows for on and pauses for off.
+func (c *AndroidContent) LEDBlink(color Color, on time.Duration, off time.Duration) error {
+	if on <= 0 {
+		return errors.New("LED glow interval should be positive")
+	}
+	if err := checkMillis(on); err != nil {
+		return fmt.Errorf("LED glow interval: %w", err)
+	}
+	if err := checkMillis(off); err != nil {
+		return fmt.Errorf("LED pause interval: %w", err)
+	}
+	c.LedColor = color.RGB()
+	c.LedInterval = int(on.Milliseconds())
+	c.LedPauseInterval = int(off.Milliseconds())
+	return nil
+}
+
+// checkMillis returns an error if d can't be sent as int milliseconds without loss
+func checkMillis(d time.Duration) error {
+	switch {
+	case d < 0:
+		return fmt.Errorf("duration %s is negative", d)
+	case d%time.Millisecond != 0:
+		return fmt.Errorf("duration %s is not whole milliseconds", d)
+	case d.Milliseconds() > math.MaxInt32:
+		return fmt.Errorf("duration %s is too long", d)
+	}
+	return nil
+}
+
+// validateAndroidFields checks formats of fields which are silently ignored by devices when malformed
+func validateAndroidFields(c *AndroidContent) error {
+	if c.IconBackground != "" && (len(c.IconBackground) != 9 || !strings.HasPrefix(c.IconBackground, "#") || !isHex(c.IconBackground[1:])) {
+		return fmt.Errorf("android icon background %q should be #AARRGGBB", c.IconBackground)
+	}
+	if c.LedColor != "" && (len(c.LedColor) != 7 || !strings.HasPrefix(c.LedColor, "#") || !isHex(c.LedColor[1:])) {
+		return fmt.Errorf("android LED color %q should be #RRGGBB", c.LedColor)
+	}
+	for _, ms := range c.Vibration {
+		if ms < 0 {
+			return errors.New("android vibration pattern should not have negative durations")
+		}
+	}
+	if c.LedInterval < 0 || c.LedPauseInterval < 0 {
+		return errors.New("android LED intervals should not be negative")
+	}
+	return nil
+}
+
+// validateHuaweiFields checks values of HMS fields, which make HMS reject the message when invalid
+func validateHuaweiFields(c *HuaweiContent) error {
+	if c.Color != "" && (len(c.Color) != 7 || !strings.HasPrefix(c.Color, "#") || !isHex(c.Color[1:])) {
+		return fmt.Errorf("huawei color %q should be #RRGGBB", c.Color)
+	}
+	if c.Importance != "" && c.Importance != "LOW" && c.Importance != "NORMAL" && c.Importance != "HIGH" {
+		return fmt.Errorf("huawei importance %q should be LOW, NORMAL or HIGH", c.Importance)
+	}
+	if c.Urgency != "" && c.Urgency != "high" && c.Urgency != "normal" {
+		return fmt.Errorf("huawei urgency %q should be high or normal", c.Urgency)
+	}
+	if c.BadgeAddNum < 0 || c.BadgeAddNum > 99 {
+		return errors.New("huawei badge add num should be from 1 to 99")
+	}
+	if c.BadgeAddNum > 0 && c.BadgeClass == "" {
+		return errors.New("huawei badge class is required to change the badge")
+	}
+	if c.Image != "" && !strings.HasPrefix(c.Image, "https://") {
+		return errors.New("huawei image should be HTTPS URL")
+	}
+	return nil
+}
+
+// SetColor is a method to set the color of the notification icon
+func (c *HuaweiContent) SetColor(color Color) {
+	c.Color = color.RGB()
+}
@@ -0,0 +1,135 @@
+package appmetrica_push
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value string
+		argb  string
+		rgb   string
+		ok    bool
+	}{
+		{"#FF8000", "#FFFF8000", "#FF8000", true},
+		{"ff8000", "#FFFF8000", "#FF8000", true},
+		{"#80ff8000", "#80FF8000", "#FF8000", true},
+		{"#FF800", "", "", false},
+		{"#GG8000", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		c, err := ParseColor(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v", tt.value, err)
+			continue
+		}
+		if tt.ok && (c.ARGB() != tt.argb || c.RGB() != tt.rgb) {
+			t.Errorf("%q: got %s and %s", tt.value, c.ARGB(), c.RGB())
+		}
+	}
+}
+
+func TestNewColor(t *testing.T) {
+	// half transparent red, premultiplied
+	c := NewColor(color.RGBA{R: 0x80, A: 0x80})
+	if c.ARGB() != "#80FF0000" {
+		t.Fatalf("got %s, want #80FF0000", c.ARGB())
+	}
+}
+
+func TestVibrationPattern(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		pattern []time.Duration
+		want    []int
+		ok      bool
+	}{
+		{"valid", []time.Duration{0, 200 * ms, 100 * ms, 300 * ms}, []int{0, 200, 100, 300}, true},
+		{"empty", nil, nil, false},
+		{"pauses only", []time.Duration{100 * ms}, nil, false},
+		{"no vibrations", []time.Duration{100 * ms, 0}, nil, false},
+		{"negative", []time.Duration{0, -ms}, nil, false},
+		{"fraction of millisecond", []time.Duration{0, 1500 * time.Microsecond}, nil, false},
+		{"too long", []time.Duration{0, 1000 * time.Hour}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewVibrationPattern(tt.pattern...)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v", err)
+			}
+			c := &AndroidContent{}
+			if err := c.SetVibration(VibrationPattern(tt.pattern)); (err == nil) != tt.ok {
+				t.Fatalf("SetVibration got error %v", err)
+			}
+			if tt.ok && (!reflect.DeepEqual(p.Millis(), tt.want) || !reflect.DeepEqual(c.Vibration, tt.want)) {
+				t.Fatalf("got %v and %v", p.Millis(), c.Vibration)
+			}
+		})
+	}
+}
+
+func TestLEDBlink(t *testing.T) {
+	red := Color{R: 0xff, A: 0x80}
+	tests := []struct {
+		name string
+		on   time.Duration
+		off  time.Duration
+		ok   bool
+	}{
+		{"valid", time.Second, 500 * time.Millisecond, true},
+		{"no pause", time.Second, 0, true},
+		{"no glow", 0, time.Second, false},
+		{"negative pause", time.Second, -time.Second, false},
+		{"fraction of millisecond", time.Second + time.Microsecond, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &AndroidContent{}
+			err := c.LEDBlink(red, tt.on, tt.off)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v", err)
+			}
+			if !tt.ok {
+				if c.LedColor != "" {
+					t.Fatal("content is changed on error")
+				}
+				return
+			}
+			if c.LedColor != "#FF0000" || c.LedInterval != int(tt.on.Milliseconds()) || c.LedPauseInterval != int(tt.off.Milliseconds()) {
+				t.Fatalf("got %s, %d and %d", c.LedColor, c.LedInterval, c.LedPauseInterval)
+			}
+		})
+	}
+}
+
+func TestValidateAndroidFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		content AndroidContent
+		ok      bool
+	}{
+		{"empty", AndroidContent{}, true},
+		{"valid", AndroidContent{IconBackground: "#FF00FF00", LedColor: "#00FF00", Vibration: []int{0, 100}, LedInterval: 100}, true},
+		{"icon background without alpha", AndroidContent{IconBackground: "#00FF00"}, false},
+		{"LED color with alpha", AndroidContent{LedColor: "#FF00FF00"}, false},
+		{"LED color without hash", AndroidContent{LedColor: "00FF00F"}, false},
+		{"negative vibration", AndroidContent{Vibration: []int{0, -1}}, false},
+		{"negative LED interval", AndroidContent{LedPauseInterval: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.content
+			c.Title, c.Text = "Title", "Text"
+			_, err := (&Message{Android: &AndroidMessage{Content: &c}}).Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package appmetrica_push
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Acceptable values of Attachment.FileType
+// Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/file-type.html
+const (
+	FileTypeJPEG  = "jpeg"
+	FileTypeGIF   = "gif"
+	FileTypePNG   = "png"
+	FileTypeAIFF  = "aiff"
+	FileTypeWAV   = "wav"
+	FileTypeMP3   = "mp3"
+	FileTypeMPEG  = "mpeg"
+	FileTypeMPEG2 = "mpeg2"
+	FileTypeMP4   = "mp4"
+	FileTypeAVI   = "avi"
+)
+
+// Max sizes of notification attachments on iOS
+const (
+	MaxIOSImageAttachmentSize = 10 << 20 // MaxIOSImageAttachmentSize is the limit of jpeg, gif and png files
+	MaxIOSAudioAttachmentSize = 5 << 20  // MaxIOSAudioAttachmentSize is the limit of aiff, wav and mp3 files
+	MaxIOSVideoAttachmentSize = 50 << 20 // MaxIOSVideoAttachmentSize is the limit of mpeg, mpeg2, mp4 and avi files
+)
+
+var (
+	fileTypesByExtension = map[string]string{
+		".jpg": FileTypeJPEG, ".jpeg": FileTypeJPEG, ".gif": FileTypeGIF, ".png": FileTypePNG,
+		".aif": FileTypeAIFF, ".aiff": FileTypeAIFF, ".wav": FileTypeWAV, ".mp3": FileTypeMP3,
+		".mpg": FileTypeMPEG, ".mpeg": FileTypeMPEG, ".m2v": FileTypeMPEG2, ".mp4": FileTypeMP4, ".m4v": FileTypeMP4,
+		".avi": FileTypeAVI,
+	}
+	fileTypesByContentType = map[string]string{
+		"image/jpeg": FileTypeJPEG, "image/pjpeg": FileTypeJPEG, "image/gif": FileTypeGIF, "image/png": FileTypePNG,
+		"audio/aiff": FileTypeAIFF, "audio/x-aiff": FileTypeAIFF, "audio/wav": FileTypeWAV, "audio/x-wav": FileTypeWAV,
+		"audio/wave": FileTypeWAV, "audio/mpeg": FileTypeMP3, "audio/mp3": FileTypeMP3, "video/mpeg": FileTypeMPEG,
+		"video/mpeg2": FileTypeMPEG2, "video/mp4": FileTypeMP4, "video/x-msvideo": FileTypeAVI, "video/avi": FileTypeAVI,
+	}
+	// genericContentTypes don't tell the file type, so it is inferred from the extension
+	genericContentTypes = map[string]bool{"": true, "application/octet-stream": true, "binary/octet-stream": true}
+)
+
+// AttachmentError describes a file which can't be attached
+type AttachmentError struct {
+	URL string // URL of the file
+	Err error  // Err describes the problem
+}
+
+func (e *AttachmentError) Error() string {
+	return fmt.Sprintf("attachment %s: %v", e.URL, e.Err)
+}
+
+func (e *AttachmentError) Unwrap() error {
+	return e.Err
+}
+
+// AttachmentBuilder builds iOS attachments from file URLs. FileType is inferred from Content-Type of the file
+// or from the extension of the URL, size is checked against iOS limits of the type.
+type AttachmentBuilder struct {
+	Checker URLChecker // Checker requests metadata of files. Default is HTTPURLChecker with http.DefaultClient
+}
+
+func NewAttachmentBuilder(checker URLChecker) *AttachmentBuilder {
+	if checker == nil {
+		checker = NewHTTPURLChecker(nil)
+	}
+	return &AttachmentBuilder{Checker: checker}
+}
+
+// Build is a method to check the file and build its attachment. Errors are returned as *AttachmentError.
+func (b *AttachmentBuilder) Build(ctx context.Context, fileURL string) (*Attachment, error) {
+	fail := func(err error) (*Attachment, error) {
+		return nil, &AttachmentError{URL: fileURL, Err: err}
+	}
+
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return fail(err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fail(fmt.Errorf("scheme %q is not supported", u.Scheme))
+	}
+
+	info, err := b.Checker.Head(ctx, fileURL)
+	if err != nil {
+		return fail(fmt.Errorf("unreachable: %w", err))
+	}
+	if err := checkReachable(info); err != nil {
+		return fail(err)
+	}
+
+	fileType, ok := inferFileType(u, info.ContentType)
+	if !ok {
+		return fail(fmt.Errorf("can't infer file type from content type %q", info.ContentType))
+	}
+	if limit := AttachmentSizeLimit(fileType); info.ContentLength > int64(limit) {
+		return fail(fmt.Errorf("%s file is %d bytes, iOS limit is %d", fileType, info.ContentLength, limit))
+	}
+
+	return &Attachment{ID: AttachmentID(fileURL), FileURL: fileURL, FileType: fileType}, nil
+}
+
+// inferFileType returns the file type by content type, or by extension of the URL if content type is generic.
+// Other content types, e.g. text/html of an error page, are never attached whatever the extension is.
+func inferFileType(u *url.URL, contentType string) (string, bool) {
+	if fileType, ok := fileTypesByContentType[contentType]; ok {
+		return fileType, true
+	}
+	if !genericContentTypes[contentType] {
+		return "", false
+	}
+	fileType, ok := fileTypesByExtension[strings.ToLower(path.Ext(u.Path))]
+	return fileType, ok
+}
+
+// BuildAll is a method to build attachments of all files. Files which can't be attached are reported
+// in the returned errors and skipped.
+func (b *AttachmentBuilder) BuildAll(ctx context.Context, fileURLs ...string) ([]*Attachment, []*AttachmentError) {
+	attachments := make([]*Attachment, 0, len(fileURLs))
+	errs := make([]*AttachmentError, 0)
+	for _, fileURL := range fileURLs {
+		a, err := b.Build(ctx, fileURL)
+		if err != nil {
+			errs = append(errs, err.(*AttachmentError))
+			continue
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, errs
+}
+
+// AttachmentID is a function to get a stable id of the attachment, the same URL always gets the same id
+func AttachmentID(fileURL string) string {
+	sum := sha256.Sum256([]byte(fileURL))
+	return "att_" + hex.EncodeToString(sum[:8])
+}
+
+// AttachmentSizeLimit is a function to get max size of the file type on iOS
+func AttachmentSizeLimit(fileType string) int {
+	switch fileType {
+	case FileTypeAIFF, FileTypeWAV, FileTypeMP3:
+		return MaxIOSAudioAttachmentSize
+	case FileTypeMPEG, FileTypeMPEG2, FileTypeMP4, FileTypeAVI:
+		return MaxIOSVideoAttachmentSize
+	default:
+		return MaxIOSImageAttachmentSize
+	}
+}
@@ -0,0 +1,109 @@
+package appmetrica_push
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fileServer serves test files and counts requests per path
+type fileServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+type testFile struct {
+	contentType string
+	body        []byte
+	size        int64 // size overrides Content-Length of HEAD responses if set
+}
+
+func newFileServer(t *testing.T, files map[string]*testFile) *fileServer {
+	s := &fileServer{requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		s.mu.Unlock()
+
+		f, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", f.contentType)
+		if f.size > 0 && r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.FormatInt(f.size, 10))
+			return
+		}
+		w.Write(f.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fileServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func pngImage(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAttachmentBuilder(t *testing.T) {
+	s := newFileServer(t, map[string]*testFile{
+		"/a.png":     {contentType: "image/png", body: pngImage(t, 2, 2)},
+		"/photo.jpg": {contentType: "application/octet-stream", body: []byte("jpeg")},
+		"/clip.mp3":  {contentType: "audio/mpeg", size: MaxIOSAudioAttachmentSize + 1},
+		"/data.bin":  {contentType: "application/octet-stream", body: []byte("data")},
+		"/login.png": {contentType: "text/html", body: []byte("<html>sign in</html>")},
+		"/raw.gif":   {contentType: "binary/octet-stream", body: []byte("gif")},
+	})
+	b := NewAttachmentBuilder(NewHTTPURLChecker(s.Client()))
+	ctx := context.Background()
+
+	tests := []struct {
+		path     string
+		fileType string
+	}{
+		{"/a.png", FileTypePNG},
+		{"/photo.jpg", FileTypeJPEG},
+		{"/clip.mp3", ""},
+		{"/data.bin", ""},
+		{"/login.png", ""},
+		{"/raw.gif", FileTypeGIF},
+		{"/missing.png", ""},
+	}
+	for _, tt := range tests {
+		a, err := b.Build(ctx, s.URL+tt.path)
+		if tt.fileType == "" {
+			var attErr *AttachmentError
+			if !errors.As(err, &attErr) || attErr.URL != s.URL+tt.path {
+				t.Errorf("%s: expected AttachmentError, got %v", tt.path, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if a.FileType != tt.fileType || a.ID != AttachmentID(s.URL+tt.path) {
+			t.Errorf("%s: unexpected attachment %+v", tt.path, a)
+		}
+	}
+}
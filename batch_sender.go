@@ -0,0 +1,183 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrSendAborted is set as the error of requests which were not sent because BatchSender.FailFast
+// stopped the run after a failed request.
+var ErrSendAborted = errors.New("sending aborted after a failed request")
+
+// BatchSender sends many PushBatchRequest with bounded concurrency.
+type BatchSender struct {
+	Client   Client       // Client used to send push requests
+	Workers  int          // Workers is the number of requests sent concurrently. Default is 1
+	Limiter  *RateLimiter // Limiter is shared by all workers and keyed by PushBatchRequest.GroupID. Nil means no limit
+	FailFast bool         // FailFast stops sending the remaining requests after the first failed one. Skipped requests are not failed
+}
+
+// BatchResult is the outcome of sending a single PushBatchRequest
+type BatchResult struct {
+	Request  *PushBatchRequest // Request that was sent
+	Response *PushResponse     // Response is nil if the request failed, was skipped or was not sent
+	Err      error             // Err is the error of sending. Requests which were not sent get the cancellation cause, e.g. ErrSendAborted
+	Skipped  bool              // Skipped is true if push filters removed all devices of the request, it is not an error
+}
+
+// BatchResults is the outcome of a BatchSender run. Results are indexed by request, so Get doesn't scan them.
+type BatchResults struct {
+	Results []*BatchResult // Results in the order requests were received
+
+	byRequest map[*PushBatchRequest]*BatchResult
+}
+
+// BatchError is returned by BatchResults.Err when some of the requests were not sent successfully
+type BatchError struct {
+	Total  int     // Total number of requests
+	Failed int     // Failed is the number of requests that failed or were not sent
+	Errors []error // Errors of the failed requests
+}
+
+func NewBatchSender(client Client, workers int) *BatchSender {
+	return &BatchSender{Client: client, Workers: workers}
+}
+
+// Send is a method to send all requests from the slice and wait for the results
+func (s *BatchSender) Send(ctx context.Context, requests []*PushBatchRequest) *BatchResults {
+	ch := make(chan *PushBatchRequest, len(requests))
+	for _, r := range requests {
+		ch <- r
+	}
+	close(ch)
+	return s.SendChan(ctx, ch)
+}
+
+// SendChan is a method to send requests received from the channel until it is closed.
+// After ctx is done requests are still drained from the channel and reported as not sent,
+// so the producer should close the channel when it stops.
+func (s *BatchSender) SendChan(ctx context.Context, requests <-chan *PushBatchRequest) *BatchResults {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	workers := s.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		results = &BatchResults{byRequest: make(map[*PushBatchRequest]*BatchResult)}
+		wg      sync.WaitGroup
+		jobs    = make(chan *BatchResult)
+	)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for res := range jobs {
+				s.send(ctx, res)
+				if res.Err != nil && s.FailFast {
+					cancel(ErrSendAborted)
+				}
+			}
+		}()
+	}
+
+	for r := range requests {
+		res := &BatchResult{Request: r}
+		results.Results = append(results.Results, res)
+		if _, ok := results.byRequest[r]; !ok {
+			results.byRequest[r] = res
+		}
+		if ctx.Err() != nil {
+			res.Err = context.Cause(ctx)
+			continue
+		}
+		select {
+		case jobs <- res:
+		case <-ctx.Done():
+			res.Err = context.Cause(ctx)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func (s *BatchSender) send(ctx context.Context, res *BatchResult) {
+	if res.Request == nil {
+		res.Err = errors.New("nil push batch request")
+		return
+	}
+	if err := s.Limiter.Wait(ctx, res.Request.GroupID); err != nil {
+		res.Err = context.Cause(ctx)
+		return
+	}
+	res.Response, res.Err = s.Client.SendPush(res.Request)
+	if errors.Is(res.Err, ErrEmptyPush) {
+		res.Skipped, res.Err = true, nil
+	}
+}
+
+// Get is a method to find the result of the request. If the request was sent several times, the first result is returned.
+func (r *BatchResults) Get(req *PushBatchRequest) *BatchResult {
+	return r.byRequest[req]
+}
+
+// Succeeded is a method to get results of the requests that were sent successfully
+func (r *BatchResults) Succeeded() []*BatchResult {
+	out := make([]*BatchResult, 0, len(r.Results))
+	for _, res := range r.Results {
+		if res.Err == nil && !res.Skipped {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Skipped is a method to get results of the requests that were not sent, since push filters removed all their devices
+func (r *BatchResults) Skipped() []*BatchResult {
+	out := make([]*BatchResult, 0)
+	for _, res := range r.Results {
+		if res.Skipped {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Failed is a method to get results of the requests that failed or were not sent
+func (r *BatchResults) Failed() []*BatchResult {
+	out := make([]*BatchResult, 0)
+	for _, res := range r.Results {
+		if res.Err != nil {
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// Err is a method to get *BatchError if any of the requests failed, nil otherwise
+func (r *BatchResults) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	e := &BatchError{Total: len(r.Results), Failed: len(failed)}
+	for _, res := range failed {
+		e.Errors = append(e.Errors, res.Err)
+	}
+	return e
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of %d push requests failed, first error: %v", e.Failed, e.Total, e.Errors[0])
+}
+
+func (e *BatchError) Unwrap() []error {
+	return e.Errors
+}
@@ -0,0 +1,92 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+)
+
+// optOutFilter removes all devices of requests with tag optout
+var optOutFilter = PushFilterFunc(func(_ context.Context, r *PushBatchRequest) error {
+	if r.Tag == "optout" {
+		r.Batch = nil
+	}
+	return nil
+})
+
+func TestBatchSenderSkipsEmptyPush(t *testing.T) {
+	var sent int32
+	c := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&sent, 1)
+		sentHandler(w, r)
+	}, WithPushFilters(optOutFilter))
+
+	requests := make([]*PushBatchRequest, 0)
+	for _, tag := range []string{"a", "optout", "b", "optout", "c"} {
+		r := testPush("appmetrica_device_id", "1")
+		r.Tag = tag
+		requests = append(requests, r)
+	}
+	s := NewBatchSender(c, 2)
+	s.FailFast = true
+	results := s.Send(context.Background(), requests)
+
+	if err := results.Err(); err != nil {
+		t.Fatalf("skipped requests should not fail the run: %v", err)
+	}
+	if len(results.Succeeded()) != 3 || len(results.Skipped()) != 2 || sent != 3 {
+		t.Fatalf("succeeded %d, skipped %d, sent %d", len(results.Succeeded()), len(results.Skipped()), sent)
+	}
+	for _, res := range results.Skipped() {
+		if res.Request.Tag != "optout" || res.Response != nil {
+			t.Fatalf("unexpected skipped result %+v", res)
+		}
+	}
+}
+
+func TestBatchSenderFailFast(t *testing.T) {
+	requests := make([]*PushBatchRequest, 0)
+	for i := 0; i < 10; i++ {
+		requests = append(requests, testPush("appmetrica_device_id", "1"))
+	}
+	s := NewBatchSender(newTestClient(failedHandler), 1)
+	s.FailFast = true
+	results := s.Send(context.Background(), requests)
+
+	if len(results.Results) != 10 || len(results.Failed()) != 10 {
+		t.Fatalf("every request should be reported, got %d results and %d failed", len(results.Results), len(results.Failed()))
+	}
+	aborted := 0
+	for _, res := range results.Results {
+		if errors.Is(res.Err, ErrSendAborted) {
+			aborted++
+		}
+	}
+	if aborted == 0 {
+		t.Fatal("requests after the failed one should be aborted")
+	}
+	var batchErr *BatchError
+	if !errors.As(results.Err(), &batchErr) || batchErr.Failed != 10 {
+		t.Fatalf("unexpected error %v", results.Err())
+	}
+}
+
+func TestBatchResultsGet(t *testing.T) {
+	requests := make([]*PushBatchRequest, 0)
+	for i := 0; i < 100; i++ {
+		requests = append(requests, testPush("appmetrica_device_id", "1"))
+	}
+	requests = append(requests, requests[0])
+	results := NewBatchSender(newTestClient(sentHandler), 4).Send(context.Background(), requests)
+
+	for i, r := range requests[:100] {
+		if res := results.Get(r); res != results.Results[i] {
+			t.Fatalf("request %d: got result of %p", i, res.Request)
+		}
+	}
+	if results.Get(testPush("appmetrica_device_id", "1")) != nil {
+		t.Fatal("request which was not sent has a result")
+	}
+}
@@ -45,6 +45,17 @@ func NewIOSOpenAction(url string) *IOSAction {
 	return &IOSAction{URL: url}
 }
 
+func NewHuaweiMessage(title string, text string, silent bool) *HuaweiMessage {
+	return &HuaweiMessage{
+		Silent:  silent,
+		Content: &HuaweiContent{Title: title, Text: text},
+	}
+}
+
+func NewHuaweiOpenAction(deeplink string) *HuaweiAction {
+	return &HuaweiAction{Deeplink: deeplink}
+}
+
 func NewDevice(idType string, idValues ...string) *Device {
 	return &Device{
 		IDType:   idType,
@@ -2,8 +2,10 @@ package appmetrica_push
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"strconv"
 )
@@ -11,16 +13,63 @@ import (
 type client struct {
 	httpClient *http.Client
 	oAuthToken string
+	gzip       *gzipOptions
+	filters    []PushFilter
+	dryRun     *DryRun
+	redirect   *Redirect
+	ctx        context.Context // ctx cancels requests of the client, see withContext. Nil means context.Background
 }
 
-func NewClient(token string) Client {
-	return &client{oAuthToken: token, httpClient: &http.Client{}}
+// ClientOption configures the client created by NewClient
+type ClientOption func(c *client)
+
+// NewClient is a function to create the client. If RedirectEnv is set, the client is in redirect mode, see WithRedirect.
+func NewClient(token string, opts ...ClientOption) Client {
+	c := &client{oAuthToken: token, httpClient: &http.Client{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.redirect == nil {
+		c.redirect = redirectFromEnv()
+	}
+	return c
+}
+
+// requestContext returns the context requests of the client are sent with
+func (c client) requestContext() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
+}
+
+// WithHTTPClient is an option to send requests with the given http.Client
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithPushFilters is an option to pass every request of SendPush through filters in the given order
+func WithPushFilters(filters ...PushFilter) ClientOption {
+	return func(c *client) {
+		c.filters = append(c.filters, filters...)
+	}
+}
+
+// WithGzip is an option to gzip request bodies larger than threshold bytes and accept gzip-encoded responses.
+// If the server answers a compressed request with 415 Unsupported Media Type, the request is repeated
+// uncompressed and bodies to that host are not compressed anymore.
+func WithGzip(threshold int) ClientOption {
+	return func(c *client) {
+		c.gzip = newGzipOptions(threshold)
+	}
 }
 
 // CreateGroup is a method to create group
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/post-groups.html
 func (c client) CreateGroup(group *Group) (*Group, error) {
-	res, err := c.sendRequest(groupEndpoint, http.MethodPost, &request{Group: group})
+	res, err := c.sendRequest(c.requestContext(), groupEndpoint, http.MethodPost, &request{Group: group})
 	if err != nil {
 		return nil, err
 	}
@@ -31,7 +80,7 @@ func (c client) CreateGroup(group *Group) (*Group, error) {
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/get-groups.html
 func (c client) GetGroups(appId int) ([]*Group, error) {
 	param := strconv.Itoa(appId)
-	res, err := c.sendRequest(groupsEndpoint+"?app_id="+param, http.MethodGet, nil)
+	res, err := c.sendRequest(c.requestContext(), groupsEndpoint+"?app_id="+param, http.MethodGet, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -42,7 +91,7 @@ func (c client) GetGroups(appId int) ([]*Group, error) {
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/get-group-id.html
 func (c client) GetGroup(id int) (*Group, error) {
 	param := strconv.Itoa(id)
-	res, err := c.sendRequest(groupEndpoint+param, http.MethodGet, nil)
+	res, err := c.sendRequest(c.requestContext(), groupEndpoint+param, http.MethodGet, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -53,7 +102,7 @@ func (c client) GetGroup(id int) (*Group, error) {
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/put-group-id.html
 func (c client) UpdateGroup(id int, group *Group) (*Group, error) {
 	param := strconv.Itoa(id)
-	res, err := c.sendRequest(groupEndpoint+param, http.MethodPut, &request{Group: group})
+	res, err := c.sendRequest(c.requestContext(), groupEndpoint+param, http.MethodPut, &request{Group: group})
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +113,7 @@ func (c client) UpdateGroup(id int, group *Group) (*Group, error) {
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/delete-group-id.html
 func (c client) ArchiveGroup(id int) error {
 	param := strconv.Itoa(id)
-	_, err := c.sendRequest(groupEndpoint+param, http.MethodDelete, nil)
+	_, err := c.sendRequest(c.requestContext(), groupEndpoint+param, http.MethodDelete, nil)
 	return err
 }
 
@@ -72,25 +121,60 @@ func (c client) ArchiveGroup(id int) error {
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/post-group-id.html
 func (c client) RestoreGroup(id int) error {
 	param := strconv.Itoa(id)
-	_, err := c.sendRequest(groupEndpoint+param+"/restore", http.MethodPost, nil)
+	_, err := c.sendRequest(c.requestContext(), groupEndpoint+param+"/restore", http.MethodPost, nil)
 	return err
 }
 
-// SendPush is a method to batch send pushes
+// SendPush is a method to batch send pushes. The request is passed through push filters of the client first,
+// ErrEmptyPush is returned if no devices are left after filtering. With WithDryRun the request is recorded instead
+// of sending. With WithRedirect the filtered request is sent to QA devices instead of its audience. In both modes
+// push recorders get the filtered request with an error, since the audience got nothing.
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/post-send-batch.html
 func (c client) SendPush(r *PushBatchRequest) (*PushResponse, error) {
-	res, err := c.sendRequest(sendEndpoint, http.MethodPost, &request{PushBatchRequest: r})
+	ctx := c.requestContext()
+	filtered, err := c.filterPush(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	r = filtered
+	if c.redirect != nil {
+		if r, err = c.redirect.apply(r); err != nil {
+			c.recordPush(ctx, filtered, nil, err)
+			return nil, err
+		}
+	}
+	if c.dryRun != nil {
+		res, err := c.dryRun.record(r)
+		if err != nil {
+			c.recordPush(ctx, filtered, nil, err)
+			return nil, err
+		}
+		c.recordPush(ctx, filtered, nil, errDryRun)
+		return res, nil
+	}
+	res, err := c.sendRequest(ctx, sendEndpoint, http.MethodPost, &request{PushBatchRequest: r})
 	if err != nil {
+		c.recordPush(ctx, filtered, nil, err)
 		return nil, err
 	}
+	if c.redirect != nil {
+		c.recordPush(ctx, filtered, res.PushResponse, errRedirected)
+	} else {
+		c.recordPush(ctx, filtered, res.PushResponse, nil)
+	}
 	return res.PushResponse, nil
 }
 
 // GetStatusByTransferId is a method to get dispatch status by transfer id
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/get-status-id.html
 func (c client) GetStatusByTransferId(transferId int) (*Transfer, error) {
+	if c.dryRun != nil {
+		if t, ok := c.dryRun.transfer(transferId); ok {
+			return t, nil
+		}
+	}
 	param := strconv.Itoa(transferId)
-	res, err := c.sendRequest(statusEndpoint+param, http.MethodGet, nil)
+	res, err := c.sendRequest(c.requestContext(), statusEndpoint+param, http.MethodGet, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -100,41 +184,38 @@ func (c client) GetStatusByTransferId(transferId int) (*Transfer, error) {
 // GetStatusByClientTransferId is a method to get dispatch status by client transfer id
 // Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/get-status-group-id.html
 func (c client) GetStatusByClientTransferId(groupId int, clientTransferId int64) (*Transfer, error) {
+	if c.dryRun != nil {
+		if t, ok := c.dryRun.transferByClientId(groupId, clientTransferId); ok {
+			return t, nil
+		}
+	}
 	p1 := strconv.Itoa(groupId)
 	p2 := strconv.FormatInt(clientTransferId, 10)
-	res, err := c.sendRequest(statusEndpoint+p1+"/"+p2, http.MethodGet, nil)
+	res, err := c.sendRequest(c.requestContext(), statusEndpoint+p1+"/"+p2, http.MethodGet, nil)
 	if err != nil {
 		return nil, err
 	}
 	return res.Transfer, nil
 }
 
-func (c client) sendRequest(endpoint string, method string, req *request) (res *response, err error) {
-	var r *http.Request
+func (c client) sendRequest(ctx context.Context, endpoint string, method string, req *request) (res *response, err error) {
 	url := host + endpoint
-	if req != nil {
-		payload, err := json.Marshal(req)
-		if err != nil {
-			return nil, err
-		}
-		r, err = http.NewRequest(method, url, bytes.NewBuffer(payload))
-	} else {
-		r, err = http.NewRequest(method, url, nil)
-	}
 
+	compress := c.gzip != nil && req != nil && !c.gzip.isRejected(url)
+	resp, compressed, err := c.do(ctx, method, url, req, compress)
 	if err != nil {
 		return nil, err
 	}
-
-	r.Header.Add("Content-Type", "application/json")
-	r.Header.Add("Authorization", "OAuth "+c.oAuthToken)
-
-	resp, err := c.httpClient.Do(r)
-	defer resp.Body.Close()
-
-	if err != nil {
-		return
+	if compressed && resp.StatusCode == http.StatusUnsupportedMediaType {
+		// server doesn't accept compressed bodies, don't compress for this host anymore
+		resp.Body.Close()
+		c.gzip.reject(url)
+		resp, _, err = c.do(ctx, method, url, req, false)
+		if err != nil {
+			return nil, err
+		}
 	}
+	defer resp.Body.Close()
 
 	err = json.NewDecoder(resp.Body).Decode(&res)
 
@@ -152,3 +233,73 @@ func (c client) sendRequest(endpoint string, method string, req *request) (res *
 
 	return
 }
+
+// do sends the request and reports whether its body was gzip-compressed
+func (c client) do(ctx context.Context, method string, url string, req *request, compress bool) (*http.Response, bool, error) {
+	body, compressed, err := c.requestBody(req, compress)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var reader io.Reader = body
+	if b, ok := body.(bytesBody); ok {
+		// net/http sets length and GetBody of bodies held in memory
+		reader = b.Reader
+	}
+	r, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		closeReader(body)
+		return nil, false, err
+	}
+	if req != nil && req.PushBatchRequest != nil {
+		// the body is returned as is, so the transport can close it and stop the encoder if it abandons a retry
+		r.GetBody = func() (io.ReadCloser, error) {
+			body, _, err := c.requestBody(req, compressed)
+			return body, err
+		}
+	}
+
+	r.Header.Add("Content-Type", "application/json")
+	r.Header.Add("Authorization", "OAuth "+c.oAuthToken)
+	if compressed {
+		r.Header.Add("Content-Encoding", "gzip")
+	}
+	if c.gzip != nil {
+		r.Header.Add("Accept-Encoding", "gzip")
+	}
+
+	resp, err := c.httpClient.Do(r)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		if err := decompressResponse(resp); err != nil {
+			resp.Body.Close()
+			return nil, false, err
+		}
+	}
+	return resp, compressed, nil
+}
+
+// requestBody encodes req. Send-batch bodies can hold hundreds of thousands of devices, so they are streamed.
+// Closing a streamed body stops its encoder.
+func (c client) requestBody(req *request, compress bool) (io.ReadCloser, bool, error) {
+	var body io.ReadCloser
+	switch {
+	case req == nil:
+		return nil, false, nil
+	case req.PushBatchRequest != nil:
+		body = streamRequest(req)
+	default:
+		payload, err := json.Marshal(req)
+		if err != nil {
+			return nil, false, err
+		}
+		body = bytesBody{bytes.NewReader(payload)}
+	}
+
+	if !compress {
+		return body, false, nil
+	}
+	return c.gzip.compress(body)
+}
@@ -0,0 +1,44 @@
+package appmetrica_push
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+)
+
+// handlerTransport serves requests of the client by the handler without network
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t *handlerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, r)
+	if r.Body != nil {
+		io.Copy(io.Discard, r.Body)
+		r.Body.Close()
+	}
+	return rec.Result(), nil
+}
+
+func newTestClient(handler http.HandlerFunc, opts ...ClientOption) Client {
+	httpClient := &http.Client{Transport: &handlerTransport{handler: handler}}
+	return NewClient("token", append([]ClientOption{WithHTTPClient(httpClient)}, opts...)...)
+}
+
+// sentHandler answers every send-batch request with a transfer id
+func sentHandler(w http.ResponseWriter, _ *http.Request) {
+	io.WriteString(w, `{"push_response":{"transfer_id":1}}`)
+}
+
+// failedHandler answers every request with an API error
+func failedHandler(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusBadRequest)
+	io.WriteString(w, `{"errors":[{"error_type":"invalid","message":"invalid request"}]}`)
+}
+
+func testPush(idType string, ids ...string) *PushBatchRequest {
+	return &PushBatchRequest{GroupID: 1, Tag: "promo", Batch: []*Batch{
+		{Messages: &Message{}, Devices: []*Device{NewDevice(idType, ids...)}},
+	}}
+}
@@ -0,0 +1,114 @@
+package appmetrica_push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// gzipOptions holds gzip settings of the client and hosts which rejected compressed bodies
+type gzipOptions struct {
+	threshold int
+
+	mu       sync.Mutex
+	rejected map[string]bool
+}
+
+func newGzipOptions(threshold int) *gzipOptions {
+	if threshold < 0 {
+		threshold = 0
+	}
+	return &gzipOptions{threshold: threshold, rejected: make(map[string]bool)}
+}
+
+func (g *gzipOptions) isRejected(rawURL string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.rejected[hostOf(rawURL)]
+}
+
+func (g *gzipOptions) reject(rawURL string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rejected[hostOf(rawURL)] = true
+}
+
+// compress reads up to threshold bytes of body. Smaller bodies are returned as is,
+// larger ones are compressed in background while they are read.
+// Closing the returned reader stops compression and closes body.
+func (g *gzipOptions) compress(body io.ReadCloser) (io.ReadCloser, bool, error) {
+	head := make([]byte, g.threshold)
+	n, err := io.ReadFull(body, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		body.Close()
+		return bytesBody{bytes.NewReader(head[:n])}, false, nil
+	}
+	if err != nil {
+		body.Close()
+		return nil, false, err
+	}
+
+	src := io.MultiReader(bytes.NewReader(head), body)
+	pr, pw := io.Pipe()
+	go func() {
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, src)
+		if closeErr := zw.Close(); err == nil {
+			err = closeErr
+		}
+		body.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr, true, nil
+}
+
+// bytesBody is a request body held in memory
+type bytesBody struct {
+	*bytes.Reader
+}
+
+func (bytesBody) Close() error {
+	return nil
+}
+
+// gzipReadCloser closes both gzip reader and the underlying response body
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.body.Close()
+}
+
+// decompressResponse replaces body of gzip-encoded response with decompressing reader
+func decompressResponse(resp *http.Response) error {
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Body = &gzipReadCloser{Reader: zr, body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+func closeReader(r io.Reader) {
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
@@ -0,0 +1,87 @@
+package appmetrica_push
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAbandonedBodyStopsEncoder(t *testing.T) {
+	c := NewClient("token", WithGzip(1024)).(*client)
+	req := benchRequest(100000)
+	before := runtime.NumGoroutine()
+
+	for _, compress := range []bool{false, true} {
+		for i := 0; i < 5; i++ {
+			body, _, err := c.requestBody(req, compress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body.Close()
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d encoder goroutines are left after bodies are closed", runtime.NumGoroutine()-before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestGzipRequestBody(t *testing.T) {
+	want, _ := json.Marshal(benchRequest(1000))
+	var got []byte
+	c := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" {
+			t.Error("body is not compressed")
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		got, _ = io.ReadAll(zr)
+		sentHandler(w, r)
+	}, WithGzip(1024))
+
+	if _, err := c.SendPush(benchRequest(1000).PushBatchRequest); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("decompressed body differs from json.Marshal")
+	}
+}
+
+func TestGzipUnsupportedFallback(t *testing.T) {
+	want, _ := json.Marshal(benchRequest(1000))
+	var compressed, plain int
+	c := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			compressed++
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		plain++
+		if got, _ := io.ReadAll(r.Body); !bytes.Equal(got, want) {
+			t.Error("repeated body differs from json.Marshal")
+		}
+		sentHandler(w, r)
+	}, WithGzip(1024))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.SendPush(benchRequest(1000).PushBatchRequest); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	// only the first request is tried compressed, later requests to the host are sent uncompressed
+	if compressed != 1 || plain != 2 {
+		t.Fatalf("got %d compressed and %d plain requests, want 1 and 2", compressed, plain)
+	}
+}
@@ -0,0 +1,205 @@
+package appmetrica_push
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed cron expression with five fields: minute, hour, day of month, month and day of week.
+// Fields support *, lists (1,15), ranges (1-5), steps (*/15, 9-18/3) and names of months (JAN) and weekdays (MON).
+// Day of week 0 and 7 both mean Sunday. As in Vixie cron, when both day fields are restricted a day matching either one matches.
+// Macros @yearly, @monthly, @weekly, @daily and @hourly are supported too.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames   = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	weekdayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// ParseCron is a function to parse cron expression, e.g. "0 10 * * MON" for every Monday at 10:00
+func ParseCron(spec string) (*CronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q should have 5 fields", spec)
+	}
+
+	var (
+		c   = &CronSchedule{}
+		err error
+	)
+	if c.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// Next is a method to get the first matching time strictly after t, in the location of t.
+// Fields are matched against the wall clock of the location. A wall time which repeats when DST ends
+// matches only its first occurrence, and wall times skipped when DST starts match the first instant after the gap,
+// so every matching wall time runs exactly once.
+// Zero time is returned if nothing matches within five years, e.g. for 30 of February.
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// wall clock is stepped in UTC, where every day has 24 hours
+	w := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := w.AddDate(5, 0, 0)
+
+	for w.Before(limit) {
+		if c.month&(1<<uint(w.Month())) == 0 {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(w.Hour())) == 0 {
+			w = w.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<uint(w.Minute())) == 0 {
+			w = w.Add(time.Minute)
+			continue
+		}
+		if at := resolveWallTime(w, loc); at.After(t) {
+			return at
+		}
+		w = w.Add(time.Minute)
+	}
+	return time.Time{}
+}
+
+// resolveWallTime returns the first instant showing wall time w in loc,
+// or the first instant after the DST gap if w falls into it
+func resolveWallTime(w time.Time, loc *time.Location) time.Time {
+	guess := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), 0, 0, loc)
+	var first, before time.Time
+	// DST transitions are never closer than a few hours, so offsets around the guess cover both sides of it
+	for _, probe := range []time.Time{guess.Add(-6 * time.Hour), guess, guess.Add(6 * time.Hour)} {
+		_, offset := probe.Zone()
+		at := w.Add(-time.Duration(offset) * time.Second).In(loc)
+		if sameWallTime(at, w) {
+			if first.IsZero() || at.Before(first) {
+				first = at
+			}
+		} else if before.IsZero() || at.Before(before) {
+			before = at
+		}
+	}
+	if !first.IsZero() {
+		return first
+	}
+
+	// w is skipped, find the end of the gap starting from the instant shown before it
+	_, offset := before.Zone()
+	for at := before; at.Before(before.Add(24 * time.Hour)); at = at.Add(time.Minute) {
+		if _, o := at.Zone(); o != offset {
+			return at.Truncate(time.Minute)
+		}
+	}
+	return guess
+}
+
+func sameWallTime(t time.Time, w time.Time) bool {
+	return t.Year() == w.Year() && t.YearDay() == w.YearDay() && t.Hour() == w.Hour() && t.Minute() == w.Minute()
+}
+
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// parseCronField returns bit set of values matching the field
+func parseCronField(field string, min int, max int, names []string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], s
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], min, names); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = parseCronValue(bounds[1], min, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 to max every 15
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(s string, min int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return i + min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	return v, nil
+}
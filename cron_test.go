@@ -0,0 +1,105 @@
+package appmetrica_push
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s is not available: %v", name, err)
+	}
+	return loc
+}
+
+func nextRuns(t *testing.T, spec string, from time.Time, n int) []time.Time {
+	t.Helper()
+	c, err := ParseCron(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs := make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		from = c.Next(from)
+		runs = append(runs, from)
+	}
+	return runs
+}
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, 1, 1, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"*/15 * * * *", time.Date(2026, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * MON", time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextFallBack(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	from := time.Date(2026, 10, 31, 12, 0, 0, 0, loc)
+
+	runs := nextRuns(t, "30 1 * * *", from, 2)
+	if want := time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC); !runs[0].Equal(want) {
+		t.Errorf("first run is %s, want first occurrence %s", runs[0], want.In(loc))
+	}
+	if want := time.Date(2026, 11, 2, 6, 30, 0, 0, time.UTC); !runs[1].Equal(want) {
+		t.Errorf("repeated wall time should be skipped, second run is %s, want %s", runs[1], want.In(loc))
+	}
+
+	// a run started during the repeated hour doesn't fire again for the same wall time
+	secondOccurrence := time.Date(2026, 11, 1, 6, 10, 0, 0, time.UTC).In(loc)
+	if got := nextRuns(t, "30 1 * * *", secondOccurrence, 1)[0]; !got.Equal(time.Date(2026, 11, 2, 6, 30, 0, 0, time.UTC)) {
+		t.Errorf("run after the first occurrence is %s", got)
+	}
+
+	// every minute of the repeated hour runs once
+	hourly := nextRuns(t, "0 * * * *", time.Date(2026, 11, 1, 0, 30, 0, 0, loc), 3)
+	for i, want := range []time.Time{
+		time.Date(2026, 11, 1, 5, 0, 0, 0, time.UTC),
+		time.Date(2026, 11, 1, 7, 0, 0, 0, time.UTC),
+		time.Date(2026, 11, 1, 8, 0, 0, 0, time.UTC),
+	} {
+		if !hourly[i].Equal(want) {
+			t.Errorf("hourly run %d is %s, want %s", i, hourly[i], want.In(loc))
+		}
+	}
+}
+
+func TestCronNextSpringForward(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	from := time.Date(2026, 3, 7, 12, 0, 0, 0, loc)
+
+	runs := nextRuns(t, "30 2 * * *", from, 2)
+	if want := time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC); !runs[0].Equal(want) {
+		t.Errorf("skipped wall time should run at the end of the gap, got %s, want %s", runs[0], want.In(loc))
+	}
+	if want := time.Date(2026, 3, 9, 6, 30, 0, 0, time.UTC); !runs[1].Equal(want) {
+		t.Errorf("second run is %s, want %s", runs[1], want.In(loc))
+	}
+
+	// several skipped wall times run once
+	quarterly := nextRuns(t, "*/15 2 * * *", time.Date(2026, 3, 8, 1, 50, 0, 0, loc), 2)
+	if want := time.Date(2026, 3, 8, 7, 0, 0, 0, time.UTC); !quarterly[0].Equal(want) {
+		t.Errorf("first run in the gap is %s, want %s", quarterly[0], want.In(loc))
+	}
+	if want := time.Date(2026, 3, 9, 6, 0, 0, 0, time.UTC); !quarterly[1].Equal(want) {
+		t.Errorf("second run is %s, want next day %s", quarterly[1], want.In(loc))
+	}
+}
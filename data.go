@@ -0,0 +1,107 @@
+package appmetrica_push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultDataBudget is the default max size of data payload in bytes. It leaves room for the rest of the message
+// within APNsPayloadLimit and FCMPayloadLimit.
+const DefaultDataBudget = 2048
+
+// DataEnvelope is a versioned wrapper of data payload, e.g. {"v":2,"type":"order","payload":{...}}.
+// It lets the app pick the parser by type and version before reading the payload.
+type DataEnvelope[T any] struct {
+	Version int    `json:"v"`       // Version of the payload schema
+	Type    string `json:"type"`    // Type of the payload
+	Payload T      `json:"payload"` // Payload itself
+}
+
+// DataOption is an option of SetData
+type DataOption func(*dataOptions)
+
+type dataOptions struct {
+	budget   int
+	envelope bool
+	version  int
+	dataType string
+}
+
+// WithDataBudget is an option to change max size of encoded data in bytes. Default is DefaultDataBudget
+func WithDataBudget(bytes int) DataOption {
+	return func(o *dataOptions) {
+		o.budget = bytes
+	}
+}
+
+// WithDataEnvelope is an option to wrap the payload into DataEnvelope with the version and type
+func WithDataEnvelope(version int, dataType string) DataOption {
+	return func(o *dataOptions) {
+		o.envelope = true
+		o.version = version
+		o.dataType = dataType
+	}
+}
+
+// SetData is a function to encode v as JSON into Data of every platform section of the message,
+// so apps on all platforms get the same payload. It fails if the encoded data exceeds the budget.
+func SetData[T any](msg *Message, v T, opts ...DataOption) error {
+	o := &dataOptions{budget: DefaultDataBudget}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if msg == nil || (msg.Android == nil && msg.IOS == nil && msg.Huawei == nil) {
+		return errors.New("message has no platform sections")
+	}
+
+	var payload interface{} = v
+	if o.envelope {
+		payload = &DataEnvelope[T]{Version: o.version, Type: o.dataType, Payload: v}
+	}
+	data, err := marshalPayload(payload)
+	if err != nil {
+		return err
+	}
+	if o.budget > 0 && len(data) > o.budget {
+		return fmt.Errorf("data is %d bytes, budget is %d", len(data), o.budget)
+	}
+
+	if msg.Android != nil {
+		if msg.Android.Content == nil {
+			msg.Android.Content = &AndroidContent{}
+		}
+		msg.Android.Content.Data = string(data)
+	}
+	if msg.IOS != nil {
+		if msg.IOS.Content == nil {
+			msg.IOS.Content = &IOSContent{}
+		}
+		msg.IOS.Content.Data = string(data)
+	}
+	if msg.Huawei != nil {
+		if msg.Huawei.Content == nil {
+			msg.Huawei.Content = &HuaweiContent{}
+		}
+		msg.Huawei.Content.Data = string(data)
+	}
+	return nil
+}
+
+// ParseData is a function to decode data set by SetData without envelope
+func ParseData[T any](s string) (T, error) {
+	var v T
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// ParseDataEnvelope is a function to decode data set by SetData with WithDataEnvelope
+func ParseDataEnvelope[T any](s string) (*DataEnvelope[T], error) {
+	e := &DataEnvelope[T]{}
+	if err := json.Unmarshal([]byte(s), e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
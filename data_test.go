@@ -0,0 +1,98 @@
+package appmetrica_push
+
+import (
+	"strings"
+	"testing"
+)
+
+type orderData struct {
+	Order string `json:"order"`
+}
+
+func TestSetDataBudget(t *testing.T) {
+	// {"order":""} is 12 bytes
+	const overhead = 12
+	tests := []struct {
+		name   string
+		size   int
+		budget int
+		ok     bool
+	}{
+		{"default budget", DefaultDataBudget - overhead, 0, true},
+		{"over default budget", DefaultDataBudget - overhead + 1, 0, false},
+		{"exactly budget", 100 - overhead, 100, true},
+		{"one byte over budget", 100 - overhead + 1, 100, false},
+		{"no budget", 10 * DefaultDataBudget, -1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []DataOption
+			if tt.budget != 0 {
+				opts = append(opts, WithDataBudget(tt.budget))
+			}
+			msg := &Message{Android: NewAndroidMessage("Title", "Text", false)}
+			err := SetData(msg, orderData{Order: strings.Repeat("a", tt.size)}, opts...)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got %v", err)
+			}
+			if set := msg.Android.Content.Data != ""; set != tt.ok {
+				t.Fatalf("data is set: %v", set)
+			}
+		})
+	}
+}
+
+func TestSetDataAllPlatforms(t *testing.T) {
+	msg := &Message{
+		Android: &AndroidMessage{},
+		IOS:     NewIOSMessage("Title", "Text", false),
+	}
+	if err := SetData(msg, orderData{Order: "42"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"order":"42"}`
+	if msg.Android.Content.Data != want || msg.IOS.Content.Data != want {
+		t.Fatalf("got %q and %q", msg.Android.Content.Data, msg.IOS.Content.Data)
+	}
+
+	got, err := ParseData[orderData](msg.IOS.Content.Data)
+	if err != nil || got.Order != "42" {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+}
+
+func TestSetDataEnvelope(t *testing.T) {
+	msg := &Message{Android: NewAndroidMessage("Title", "Text", false)}
+	if err := SetData(msg, orderData{Order: "42"}, WithDataEnvelope(2, "order")); err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"v":2,"type":"order","payload":{"order":"42"}}`; msg.Android.Content.Data != want {
+		t.Fatalf("got %s, want %s", msg.Android.Content.Data, want)
+	}
+
+	e, err := ParseDataEnvelope[orderData](msg.Android.Content.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Version != 2 || e.Type != "order" || e.Payload.Order != "42" {
+		t.Fatalf("got %+v", e)
+	}
+}
+
+func TestSetDataErrors(t *testing.T) {
+	if err := SetData(nil, orderData{}); err == nil {
+		t.Error("nil message should fail")
+	}
+	if err := SetData(&Message{}, orderData{}); err == nil {
+		t.Error("message without platform sections should fail")
+	}
+	if err := SetData(&Message{IOS: &IOSMessage{}}, func() {}); err == nil {
+		t.Error("value which can't be encoded should fail")
+	}
+	if _, err := ParseData[orderData](`{"order":`); err == nil {
+		t.Error("malformed data should fail")
+	}
+	if _, err := ParseDataEnvelope[orderData](`[]`); err == nil {
+		t.Error("malformed envelope should fail")
+	}
+}
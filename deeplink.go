@@ -0,0 +1,177 @@
+package appmetrica_push
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DeeplinkBuilder builds deeplinks for open actions of push messages. Links are checked against the allowlist
+// of schemes and hosts the app registered, path segments and query are escaped,
+// and campaign parameters are added from the tag of the request.
+type DeeplinkBuilder struct {
+	Schemes   []string // Schemes the app handles, e.g. myapp or https. Required
+	Hosts     []string // Hosts the app handles. Host starting with a dot matches its subdomains, e.g. .example.com. Empty means any host
+	UTMSource string   // UTMSource is the value of utm_source. Default is appmetrica
+	UTMMedium string   // UTMMedium is the value of utm_medium. Default is push
+}
+
+// Deeplink is an unescaped link, escaping is done by DeeplinkBuilder
+type Deeplink struct {
+	Scheme string     // Scheme of the link, e.g. myapp
+	Host   string     // Host of the link, e.g. catalog
+	Path   []string   // Path segments, e.g. "product", "42"
+	Query  url.Values // Query parameters
+}
+
+func NewDeeplinkBuilder(schemes []string, hosts ...string) *DeeplinkBuilder {
+	return &DeeplinkBuilder{Schemes: schemes, Hosts: hosts, UTMSource: "appmetrica", UTMMedium: "push"}
+}
+
+func NewDeeplink(scheme string, host string, path ...string) *Deeplink {
+	return &Deeplink{Scheme: scheme, Host: host, Path: path, Query: make(url.Values)}
+}
+
+// ParseDeeplink is a function to parse an already escaped link, e.g. to add campaign parameters to it
+func ParseDeeplink(raw string) (*Deeplink, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	d := NewDeeplink(u.Scheme, u.Host)
+	// segments are split before unescaping, so escaped slashes stay inside their segment
+	for _, escaped := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		if escaped == "" {
+			continue
+		}
+		segment, err := url.PathUnescape(escaped)
+		if err != nil {
+			return nil, err
+		}
+		d.Path = append(d.Path, segment)
+	}
+	d.Query = u.Query()
+	return d, nil
+}
+
+// With is a method to set the query parameter of the link
+func (d *Deeplink) With(key string, value string) *Deeplink {
+	if d.Query == nil {
+		d.Query = make(url.Values)
+	}
+	d.Query.Set(key, value)
+	return d
+}
+
+// Build is a method to validate the link and escape it. Campaign parameters utm_source, utm_medium and
+// utm_campaign with the tag are added unless the link already has them or the tag is empty.
+func (b *DeeplinkBuilder) Build(d *Deeplink, tag string) (string, error) {
+	if err := b.check(d); err != nil {
+		return "", err
+	}
+
+	query := make(url.Values, len(d.Query)+3)
+	for k, v := range d.Query {
+		query[k] = append([]string(nil), v...)
+	}
+	if tag != "" {
+		setDefault(query, "utm_source", b.UTMSource)
+		setDefault(query, "utm_medium", b.UTMMedium)
+		setDefault(query, "utm_campaign", tag)
+	}
+
+	u := &url.URL{Scheme: strings.ToLower(d.Scheme), Host: d.Host, RawQuery: query.Encode()}
+	if len(d.Path) > 0 {
+		escaped := make([]string, len(d.Path))
+		for i, segment := range d.Path {
+			escaped[i] = url.PathEscape(segment)
+		}
+		u.Path = "/" + strings.Join(d.Path, "/")
+		u.RawPath = "/" + strings.Join(escaped, "/")
+	}
+	return u.String(), nil
+}
+
+// Actions is a method to build open actions of both platforms with the same link
+func (b *DeeplinkBuilder) Actions(d *Deeplink, tag string) (*AndroidAction, *IOSAction, error) {
+	link, err := b.Build(d, tag)
+	if err != nil {
+		return nil, nil, err
+	}
+	return NewAndroidOpenAction(link), NewIOSOpenAction(link), nil
+}
+
+// SetOpenActions is a method to set the link as open action of every platform section of every batch of the request.
+// Messages are copied before the change, since the same message is often shared by several requests with different tags.
+func (b *DeeplinkBuilder) SetOpenActions(r *PushBatchRequest, d *Deeplink) error {
+	link, err := b.Build(d, r.Tag)
+	if err != nil {
+		return err
+	}
+	for _, batch := range r.Batch {
+		if batch == nil || batch.Messages == nil {
+			continue
+		}
+		m := *batch.Messages
+		if m.Android != nil {
+			a := *m.Android
+			a.OpenAction = NewAndroidOpenAction(link)
+			m.Android = &a
+		}
+		if m.IOS != nil {
+			i := *m.IOS
+			i.OpenAction = NewIOSOpenAction(link)
+			m.IOS = &i
+		}
+		if m.Huawei != nil {
+			h := *m.Huawei
+			h.OpenAction = NewHuaweiOpenAction(link)
+			m.Huawei = &h
+		}
+		batch.Messages = &m
+	}
+	return nil
+}
+
+func (b *DeeplinkBuilder) check(d *Deeplink) error {
+	if d == nil || d.Scheme == "" {
+		return errors.New("deeplink scheme is required")
+	}
+	if !containsFold(b.Schemes, d.Scheme) {
+		return fmt.Errorf("deeplink scheme %q is not allowed", d.Scheme)
+	}
+	if d.Host == "" {
+		return errors.New("deeplink host is required")
+	}
+	if strings.ContainsAny(d.Host, "/?#@ ") {
+		return fmt.Errorf("deeplink host %q is invalid", d.Host)
+	}
+	if len(b.Hosts) == 0 {
+		return nil
+	}
+
+	host := strings.ToLower(d.Host)
+	for _, allowed := range b.Hosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("deeplink host %q is not allowed", d.Host)
+}
+
+func setDefault(query url.Values, key string, value string) {
+	if value != "" && query.Get(key) == "" {
+		query.Set(key, value)
+	}
+}
+
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
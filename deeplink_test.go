@@ -0,0 +1,111 @@
+package appmetrica_push
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeeplinkBuild(t *testing.T) {
+	b := NewDeeplinkBuilder([]string{"myapp", "https"}, "catalog", ".example.com")
+	tests := []struct {
+		name string
+		link *Deeplink
+		tag  string
+		want string
+	}{
+		{"campaign", NewDeeplink("myapp", "catalog", "product", "42"), "sale",
+			"myapp://catalog/product/42?utm_campaign=sale&utm_medium=push&utm_source=appmetrica"},
+		{"no tag", NewDeeplink("myapp", "catalog"), "", "myapp://catalog"},
+		{"escaped segments", NewDeeplink("myapp", "catalog", "a/b", "c d", "é?"), "",
+			"myapp://catalog/a%2Fb/c%20d/%C3%A9%3F"},
+		{"escaped query", NewDeeplink("myapp", "catalog").With("q", "a&b=c"), "", "myapp://catalog?q=a%26b%3Dc"},
+		{"existing campaign", NewDeeplink("myapp", "catalog").With("utm_campaign", "spring").With("utm_source", "mail"), "sale",
+			"myapp://catalog?utm_campaign=spring&utm_medium=push&utm_source=mail"},
+		{"subdomain", NewDeeplink("HTTPS", "shop.example.com", "x"), "", "https://shop.example.com/x"},
+		{"host case", NewDeeplink("myapp", "Catalog"), "", "myapp://Catalog"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := b.Build(tt.link, tt.tag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeeplinkBuildRejects(t *testing.T) {
+	b := NewDeeplinkBuilder([]string{"myapp", "https"}, "catalog", ".example.com")
+	tests := []struct {
+		name string
+		link *Deeplink
+	}{
+		{"nil link", nil},
+		{"no scheme", NewDeeplink("", "catalog")},
+		{"scheme not allowed", NewDeeplink("javascript", "catalog")},
+		{"no host", NewDeeplink("myapp", "")},
+		{"host not allowed", NewDeeplink("myapp", "profile")},
+		{"domain suffix", NewDeeplink("https", "evilexample.com")},
+		{"bare domain of subdomain rule", NewDeeplink("https", "example.com")},
+		{"userinfo", NewDeeplink("https", "evil.com@shop.example.com")},
+		{"path in host", NewDeeplink("myapp", "catalog/../profile")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if link, err := b.Build(tt.link, "sale"); err == nil {
+				t.Fatalf("got %s", link)
+			}
+		})
+	}
+}
+
+func TestDeeplinkAnyHost(t *testing.T) {
+	b := NewDeeplinkBuilder([]string{"myapp"})
+	if _, err := b.Build(NewDeeplink("myapp", "anything"), ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseDeeplink(t *testing.T) {
+	d, err := ParseDeeplink("myapp://catalog/a%2Fb/c%20d?q=1&utm_source=mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Scheme != "myapp" || d.Host != "catalog" || !reflect.DeepEqual(d.Path, []string{"a/b", "c d"}) {
+		t.Fatalf("got %+v", d)
+	}
+
+	b := NewDeeplinkBuilder([]string{"myapp"})
+	got, err := b.Build(d, "sale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "myapp://catalog/a%2Fb/c%20d?q=1&utm_campaign=sale&utm_medium=push&utm_source=mail"; got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestDeeplinkSetOpenActions(t *testing.T) {
+	shared := &Message{
+		Android: NewAndroidMessage("Title", "Text", false),
+		IOS:     NewIOSMessage("Title", "Text", false),
+	}
+	r := testPush(IDTypeAppmetricaDeviceID, "1")
+	r.Batch[0].Messages = shared
+
+	b := NewDeeplinkBuilder([]string{"myapp"})
+	if err := b.SetOpenActions(r, NewDeeplink("myapp", "catalog")); err != nil {
+		t.Fatal(err)
+	}
+	want := "myapp://catalog?utm_campaign=promo&utm_medium=push&utm_source=appmetrica"
+	m := r.Batch[0].Messages
+	if m.Android.OpenAction.Deeplink != want || m.IOS.OpenAction.URL != want {
+		t.Fatalf("got %+v and %+v", m.Android.OpenAction, m.IOS.OpenAction)
+	}
+	if shared.Android.OpenAction != nil || shared.IOS.OpenAction != nil {
+		t.Fatal("shared message is changed")
+	}
+}
@@ -0,0 +1,119 @@
+package appmetrica_push
+
+import (
+	"strings"
+)
+
+// Confidence is how sure DetectIDType is about the detected type
+type Confidence int
+
+const (
+	ConfidenceNone   Confidence = iota // Type is unknown
+	ConfidenceLow                      // Value has a shape shared by several types
+	ConfidenceMedium                   // Value most likely has the detected type
+	ConfidenceHigh                     // Value has a shape specific to the detected type
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceLow:
+		return "low"
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceHigh:
+		return "high"
+	}
+	return "none"
+}
+
+// DetectIDType is a function to infer the most likely Device.IDType from the format of raw id:
+//   - hex string of 64 or more digits (optionally in NSData <...> form) is APNs token, high confidence
+//   - token with ":APA91b" is FCM token, high confidence; other long "instance:token" values are FCM tokens with medium confidence
+//   - uppercase UUID is ios_ifa with medium confidence, lowercase UUID is google_aid with low confidence since huawei_oaid looks the same
+//   - number is appmetrica_device_id with medium confidence
+//   - long url-safe token without colon is huawei_push_token with low confidence
+//
+// Empty IDType and ConfidenceNone are returned for unknown formats.
+func DetectIDType(id string) (string, Confidence) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return "", ConfidenceNone
+	}
+
+	if token, err := NormalizeDeviceID(IDTypeIOSPushToken, id); err == nil && len(token) >= 64 {
+		return IDTypeIOSPushToken, ConfidenceHigh
+	}
+
+	if uuid, ok := canonicalUUID(id); ok {
+		bare := strings.Trim(id, "{}")
+		switch {
+		case bare == strings.ToUpper(uuid):
+			return IDTypeIOSIFA, ConfidenceMedium
+		case bare == uuid:
+			return IDTypeGoogleAID, ConfidenceLow
+		}
+		return IDTypeIOSIFA, ConfidenceLow
+	}
+
+	if isDigits(id) && len(id) <= 20 {
+		return IDTypeAppmetricaDeviceID, ConfidenceMedium
+	}
+
+	if instance, token, ok := strings.Cut(id, ":"); ok && isURLSafe(instance) && isURLSafe(token) {
+		if strings.HasPrefix(token, "APA91b") {
+			return IDTypeAndroidPushToken, ConfidenceHigh
+		}
+		if len(id) >= 100 {
+			return IDTypeAndroidPushToken, ConfidenceMedium
+		}
+		return "", ConfidenceNone
+	}
+
+	if len(id) >= 64 && isURLSafe(id) {
+		return IDTypeHuaweiPushToken, ConfidenceLow
+	}
+
+	return "", ConfidenceNone
+}
+
+// ClassifyDevices is a function to bucket raw ids into devices by detected IDType.
+// Ids detected with confidence lower than minConfidence are returned as ambiguous.
+// Ids are normalized with NormalizeDeviceID, duplicates are kept.
+func ClassifyDevices(ids []string, minConfidence Confidence) (devices []*Device, ambiguous []string) {
+	if minConfidence < ConfidenceLow {
+		minConfidence = ConfidenceLow
+	}
+
+	byType := make(map[string]*Device)
+	for _, raw := range ids {
+		idType, confidence := DetectIDType(raw)
+		if confidence < minConfidence {
+			ambiguous = append(ambiguous, raw)
+			continue
+		}
+		id, err := NormalizeDeviceID(idType, raw)
+		if err != nil {
+			ambiguous = append(ambiguous, raw)
+			continue
+		}
+
+		d, ok := byType[idType]
+		if !ok {
+			d = NewDevice(idType)
+			byType[idType] = d
+			devices = append(devices, d)
+		}
+		d.IDValues = append(d.IDValues, id)
+	}
+	return devices, ambiguous
+}
+
+func isURLSafe(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return s != ""
+}
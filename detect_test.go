@@ -0,0 +1,94 @@
+package appmetrica_push
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectIDType(t *testing.T) {
+	apns := strings.Repeat("0a1b2c3d", 8)
+	tests := []struct {
+		id         string
+		idType     string
+		confidence Confidence
+	}{
+		{"", "", ConfidenceNone},
+		{"  ", "", ConfidenceNone},
+		{apns, IDTypeIOSPushToken, ConfidenceHigh},
+		{strings.ToUpper(apns), IDTypeIOSPushToken, ConfidenceHigh},
+		{"<0a1b2c3d 0a1b2c3d 0a1b2c3d 0a1b2c3d 0a1b2c3d 0a1b2c3d 0a1b2c3d 0a1b2c3d>", IDTypeIOSPushToken, ConfidenceHigh},
+		{apns[:62], "", ConfidenceNone},
+		{strings.Repeat("1", 64), IDTypeIOSPushToken, ConfidenceHigh},
+		{"6F9619FF-8B86-D011-B42D-00C04FC964FF", IDTypeIOSIFA, ConfidenceMedium},
+		{"{6F9619FF-8B86-D011-B42D-00C04FC964FF}", IDTypeIOSIFA, ConfidenceMedium},
+		{"6f9619ff-8b86-d011-b42d-00c04fc964ff", IDTypeGoogleAID, ConfidenceLow},
+		{"6F9619FF-8b86-d011-b42d-00c04fc964ff", IDTypeIOSIFA, ConfidenceLow},
+		{"12345678901234567890", IDTypeAppmetricaDeviceID, ConfidenceMedium},
+		{"123456789012345678901", "", ConfidenceNone},
+		{"cXsf1:APA91bHqL", IDTypeAndroidPushToken, ConfidenceHigh},
+		{"cXsf1:" + strings.Repeat("x", 100), IDTypeAndroidPushToken, ConfidenceMedium},
+		{"cXsf1:short", "", ConfidenceNone},
+		{"a:b:c", "", ConfidenceNone},
+		{strings.Repeat("Hw_", 22), IDTypeHuaweiPushToken, ConfidenceLow},
+		{"qa@example.com", "", ConfidenceNone},
+	}
+	for _, tt := range tests {
+		idType, confidence := DetectIDType(tt.id)
+		if idType != tt.idType || confidence != tt.confidence {
+			t.Errorf("%q: got %q with %s confidence, want %q with %s", tt.id, idType, confidence, tt.idType, tt.confidence)
+		}
+	}
+}
+
+func TestClassifyDevices(t *testing.T) {
+	ids := []string{
+		"12345",
+		" 6F9619FF-8B86-D011-B42D-00C04FC964FF ",
+		"6f9619ff-8b86-d011-b42d-00c04fc964ff",
+		"12345",
+		"qa@example.com",
+	}
+	tests := []struct {
+		name      string
+		min       Confidence
+		devices   []*Device
+		ambiguous []string
+	}{
+		{
+			name: "low",
+			min:  ConfidenceNone,
+			devices: []*Device{
+				NewDevice(IDTypeAppmetricaDeviceID, "12345", "12345"),
+				NewDevice(IDTypeIOSIFA, "6F9619FF-8B86-D011-B42D-00C04FC964FF"),
+				NewDevice(IDTypeGoogleAID, "6f9619ff-8b86-d011-b42d-00c04fc964ff"),
+			},
+			ambiguous: []string{"qa@example.com"},
+		},
+		{
+			name: "medium",
+			min:  ConfidenceMedium,
+			devices: []*Device{
+				NewDevice(IDTypeAppmetricaDeviceID, "12345", "12345"),
+				NewDevice(IDTypeIOSIFA, "6F9619FF-8B86-D011-B42D-00C04FC964FF"),
+			},
+			ambiguous: []string{"6f9619ff-8b86-d011-b42d-00c04fc964ff", "qa@example.com"},
+		},
+		{
+			name:      "high",
+			min:       ConfidenceHigh,
+			ambiguous: ids,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, ambiguous := ClassifyDevices(ids, tt.min)
+			if !reflect.DeepEqual(devices, tt.devices) {
+				t.Errorf("got devices %+v", devices)
+			}
+			if !reflect.DeepEqual(ambiguous, tt.ambiguous) {
+				t.Errorf("got ambiguous %q", ambiguous)
+			}
+		})
+	}
+}
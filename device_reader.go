@@ -0,0 +1,215 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineSize is the longest line NDJSON and plain text readers accept
+const maxLineSize = 1 << 20
+
+// DeviceReader streams devices from a source one by one, so the whole audience is never loaded into memory.
+// Read returns a Device with a single id value, *RowError for a malformed row (reading can continue after it)
+// and io.EOF when there are no more devices.
+type DeviceReader interface {
+	Read() (*Device, error)
+}
+
+// RowError is returned by DeviceReader for a malformed row
+type RowError struct {
+	Line int   // Line number of the row, starting from 1
+	Err  error // Err describes what is wrong with the row
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// CSVDeviceReader reads devices from CSV with a header row.
+type CSVDeviceReader struct {
+	IDColumn     string // IDColumn is the header of the column with device ids
+	IDTypeColumn string // IDTypeColumn is the header of the column with id types. If empty, IDType is used for every row
+	IDType       string // IDType of every row when IDTypeColumn is empty
+	Comma        rune   // Comma is the field delimiter. Default is ','
+
+	r        io.Reader
+	csv      *csv.Reader
+	idIdx    int
+	typeIdx  int
+	maxIndex int
+}
+
+func NewCSVDeviceReader(r io.Reader, idColumn string, idType string) *CSVDeviceReader {
+	return &CSVDeviceReader{r: r, IDColumn: idColumn, IDType: idType, Comma: ','}
+}
+
+func (c *CSVDeviceReader) Read() (*Device, error) {
+	if c.csv == nil {
+		if err := c.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := c.csv.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &RowError{Line: parseErr.Line, Err: parseErr.Err}
+		}
+		return nil, err
+	}
+	line, _ := c.csv.FieldPos(0)
+
+	if len(record) <= c.maxIndex {
+		return nil, &RowError{Line: line, Err: fmt.Errorf("expected at least %d fields, got %d", c.maxIndex+1, len(record))}
+	}
+
+	idType := c.IDType
+	if c.typeIdx >= 0 {
+		idType = strings.TrimSpace(record[c.typeIdx])
+	}
+	return newDeviceFromRow(line, idType, record[c.idIdx])
+}
+
+func (c *CSVDeviceReader) readHeader() error {
+	c.csv = csv.NewReader(c.r)
+	c.csv.Comma = c.Comma
+	c.csv.FieldsPerRecord = -1
+	c.csv.ReuseRecord = true
+
+	header, err := c.csv.Read()
+	if err == io.EOF {
+		return errors.New("csv header is missing")
+	}
+	if err != nil {
+		return err
+	}
+
+	c.idIdx, c.typeIdx = -1, -1
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == c.IDColumn {
+			c.idIdx = i
+		} else if c.IDTypeColumn != "" && name == c.IDTypeColumn {
+			c.typeIdx = i
+		}
+	}
+	if c.idIdx < 0 {
+		return fmt.Errorf("csv column %q not found", c.IDColumn)
+	}
+	if c.IDTypeColumn != "" && c.typeIdx < 0 {
+		return fmt.Errorf("csv column %q not found", c.IDTypeColumn)
+	}
+
+	c.maxIndex = c.idIdx
+	if c.typeIdx > c.maxIndex {
+		c.maxIndex = c.typeIdx
+	}
+	return nil
+}
+
+// NDJSONDeviceReader reads devices from newline-delimited JSON objects, e.g. {"id_type": "ios_push_token", "id_value": "..."}.
+type NDJSONDeviceReader struct {
+	IDField     string // IDField is the object key of the device id. Default is "id_value"
+	IDTypeField string // IDTypeField is the object key of the id type. Default is "id_type"
+	IDType      string // IDType is used when the object has no IDTypeField
+
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewNDJSONDeviceReader(r io.Reader) *NDJSONDeviceReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &NDJSONDeviceReader{scanner: s, IDField: "id_value", IDTypeField: "id_type"}
+}
+
+func (n *NDJSONDeviceReader) Read() (*Device, error) {
+	line, err := nextLine(n.scanner, &n.line)
+	if err != nil {
+		return nil, err
+	}
+
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &row); err != nil {
+		return nil, &RowError{Line: n.line, Err: err}
+	}
+
+	var id string
+	if err := json.Unmarshal(row[n.IDField], &id); err != nil {
+		return nil, &RowError{Line: n.line, Err: fmt.Errorf("%q should be a string", n.IDField)}
+	}
+	idType := n.IDType
+	if raw, ok := row[n.IDTypeField]; ok {
+		if err := json.Unmarshal(raw, &idType); err != nil {
+			return nil, &RowError{Line: n.line, Err: fmt.Errorf("%q should be a string", n.IDTypeField)}
+		}
+	}
+	return newDeviceFromRow(n.line, idType, id)
+}
+
+// LineDeviceReader reads one device id of the same type per line. Empty lines are skipped.
+type LineDeviceReader struct {
+	IDType string // IDType of every device
+
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewLineDeviceReader(r io.Reader, idType string) *LineDeviceReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return &LineDeviceReader{scanner: s, IDType: idType}
+}
+
+func (l *LineDeviceReader) Read() (*Device, error) {
+	line, err := nextLine(l.scanner, &l.line)
+	if err != nil {
+		return nil, err
+	}
+	return newDeviceFromRow(l.line, l.IDType, line)
+}
+
+// nextLine returns the next non-empty line and advances the line counter
+func nextLine(s *bufio.Scanner, counter *int) (string, error) {
+	for s.Scan() {
+		*counter++
+		line := strings.TrimSpace(s.Text())
+		if line != "" {
+			return line, nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
+
+func newDeviceFromRow(line int, idType string, id string) (*Device, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, &RowError{Line: line, Err: errors.New("device id is empty")}
+	}
+	if !isKnownIDType(idType) {
+		return nil, &RowError{Line: line, Err: fmt.Errorf("unknown id_type %q", idType)}
+	}
+	return NewDevice(idType, id), nil
+}
+
+func isKnownIDType(idType string) bool {
+	switch idType {
+	case IDTypeAppmetricaDeviceID, IDTypeIOSIFA, IDTypeGoogleAID, IDTypeAndroidPushToken,
+		IDTypeIOSPushToken, IDTypeHuaweiPushToken, IDTypeHuaweiOAID:
+		return true
+	}
+	return false
+}
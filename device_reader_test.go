@@ -0,0 +1,127 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// readAll reads devices until io.EOF, collecting lines of malformed rows
+func readAll(r DeviceReader) ([]*Device, []int, error) {
+	devices := make([]*Device, 0)
+	malformed := make([]int, 0)
+	for {
+		d, err := r.Read()
+		if err == io.EOF {
+			return devices, malformed, nil
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			malformed = append(malformed, rowErr.Line)
+			continue
+		}
+		if err != nil {
+			return devices, malformed, err
+		}
+		devices = append(devices, d)
+	}
+}
+
+func TestDeviceReaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		reader    DeviceReader
+		ids       []string
+		malformed []int
+	}{
+		{
+			name: "csv with type column",
+			reader: func() DeviceReader {
+				r := NewCSVDeviceReader(strings.NewReader("id_type,id_value\nios_push_token,ab\nemail,x\nappmetrica_device_id,\nappmetrica_device_id\nappmetrica_device_id, 42 \n"), "id_value", "")
+				r.IDTypeColumn = "id_type"
+				return r
+			}(),
+			ids:       []string{"ios_push_token:ab", "appmetrica_device_id:42"},
+			malformed: []int{3, 4, 5},
+		},
+		{
+			name: "csv with semicolons",
+			reader: func() DeviceReader {
+				r := NewCSVDeviceReader(strings.NewReader("user;device\nu1;1\nu2;\"2\n"), "device", IDTypeAppmetricaDeviceID)
+				r.Comma = ';'
+				return r
+			}(),
+			ids:       []string{"appmetrica_device_id:1"},
+			malformed: []int{3},
+		},
+		{
+			name:      "ndjson",
+			reader:    NewNDJSONDeviceReader(strings.NewReader("{\"id_type\":\"ios_push_token\",\"id_value\":\"ab\"}\n\n{\"id_value\":1}\nnot json\n{\"id_type\":\"google_aid\",\"id_value\":\"cd\"}\n")),
+			ids:       []string{"ios_push_token:ab", "google_aid:cd"},
+			malformed: []int{3, 4},
+		},
+		{
+			name:      "lines",
+			reader:    NewLineDeviceReader(strings.NewReader("1\n\n  2  \n"), IDTypeAppmetricaDeviceID),
+			ids:       []string{"appmetrica_device_id:1", "appmetrica_device_id:2"},
+			malformed: []int{},
+		},
+		{
+			name:      "lines of unknown type",
+			reader:    NewLineDeviceReader(strings.NewReader("1\n2\n"), "email"),
+			ids:       []string{},
+			malformed: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, malformed, err := readAll(tt.reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]string, 0, len(devices))
+			for _, d := range devices {
+				ids = append(ids, d.IDType+":"+strings.Join(d.IDValues, ","))
+			}
+			if strings.Join(ids, " ") != strings.Join(tt.ids, " ") {
+				t.Errorf("got devices %v, want %v", ids, tt.ids)
+			}
+			if len(malformed) != len(tt.malformed) {
+				t.Fatalf("got malformed lines %v, want %v", malformed, tt.malformed)
+			}
+			for i := range malformed {
+				if malformed[i] != tt.malformed[i] {
+					t.Fatalf("got malformed lines %v, want %v", malformed, tt.malformed)
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceReaderErrors(t *testing.T) {
+	long := strings.Repeat("a", maxLineSize+1)
+	tests := []struct {
+		name   string
+		reader DeviceReader
+		want   error
+	}{
+		{"line too long", NewLineDeviceReader(strings.NewReader("1\n"+long+"\n"), IDTypeAppmetricaDeviceID), bufio.ErrTooLong},
+		{"ndjson line too long", NewNDJSONDeviceReader(strings.NewReader(long)), bufio.ErrTooLong},
+		{"csv without header", NewCSVDeviceReader(strings.NewReader(""), "id", IDTypeAppmetricaDeviceID), nil},
+		{"csv without id column", NewCSVDeviceReader(strings.NewReader("device\n1\n"), "id", IDTypeAppmetricaDeviceID), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readAll(tt.reader)
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			var rowErr *RowError
+			if errors.As(err, &rowErr) {
+				t.Fatalf("reading should stop, got row error %v", err)
+			}
+		})
+	}
+}
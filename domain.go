@@ -1,5 +1,7 @@
 package appmetrica_push
 
+import "time"
+
 type Client interface {
 	CreateGroup(group *Group) (*Group, error)
 	GetGroups(appId int) ([]*Group, error)
@@ -12,11 +14,31 @@ type Client interface {
 	GetStatusByClientTransferId(groupId int, clientTransferId int64) (*Transfer, error)
 }
 
+// TransferStatus is a status of the dispatch. Statuses unknown to this library are kept as is.
+type TransferStatus string
+
+const (
+	TransferStatusFailed     TransferStatus = "failed"
+	TransferStatusInProgress TransferStatus = "in_progress"
+	TransferStatusPending    TransferStatus = "pending"
+	TransferStatusSent       TransferStatus = "sent"
+)
+
+// Acceptable values of Device.IDType
 const (
-	TransferStatusFailed     = "failed"
-	TransferStatusInProgress = "in_progress"
-	TransferStatusPending    = "pending"
-	TransferStatusSent       = "sent"
+	IDTypeAppmetricaDeviceID = "appmetrica_device_id"
+	IDTypeIOSIFA             = "ios_ifa"
+	IDTypeGoogleAID          = "google_aid"
+	IDTypeAndroidPushToken   = "android_push_token"
+	IDTypeIOSPushToken       = "ios_push_token"
+	IDTypeHuaweiPushToken    = "huawei_push_token"
+	IDTypeHuaweiOAID         = "huawei_oaid"
+)
+
+// Limits of a single send-batch request
+const (
+	MaxDevicesPerRequest      = 250000 // MaxDevicesPerRequest is the total number of devices in all groups of one request
+	MaxDeviceGroupsPerRequest = 5      // MaxDeviceGroupsPerRequest is the number of id_type groups in one request
 )
 
 type (
@@ -56,13 +78,14 @@ type (
 	// Documentation: https://appmetrica.yandex.com/docs/mobile-api/push/get-status-id.html
 	// https://appmetrica.yandex.com/docs/mobile-api/push/get-status-group-id.html
 	Transfer struct {
-		ID               int      `json:"id"`                           // id of the dispatch
-		GroupId          int      `json:"group_id"`                     // id of the Group
-		Status           string   `json:"status"`                       // Status of the dispatch. Can be failed, in_progress, pending, sent, see TransferStatus consts
-		Errors           []string `json:"errors"`                       // Errors list
-		Tag              string   `json:"tag"`                          // The dispatch Tag. A tag is an arbitrary string that labels every sending by the API. You can label an arbitrary number of sendings by one tag. The report displays tag at the second level.
-		CreationDate     string   `json:"creation_date"`                // The Date the dispatch request was created.
-		ClientTransferId *int64   `json:"client_transfer_id,omitempty"` // Sending ID specified by the user in the body of the SendBatch request. Would be nil, if Transfer is requested by TransferId, not ClientTransferId and GroupId
+		ID               int            `json:"id"`                           // id of the dispatch
+		GroupId          int            `json:"group_id"`                     // id of the Group
+		Status           TransferStatus `json:"status"`                       // Status of the dispatch. Can be failed, in_progress, pending, sent, see TransferStatus consts
+		Errors           []string       `json:"errors"`                       // Errors list
+		Tag              string         `json:"tag"`                          // The dispatch Tag. A tag is an arbitrary string that labels every sending by the API. You can label an arbitrary number of sendings by one tag. The report displays tag at the second level.
+		CreationDate     string         `json:"creation_date"`                // The Date the dispatch request was created, raw value as returned by API.
+		CreatedAt        time.Time      `json:"-"`                            // CreatedAt is CreationDate parsed on unmarshalling. Zero if CreationDate is in unknown format
+		ClientTransferId *int64         `json:"client_transfer_id,omitempty"` // Sending ID specified by the user in the body of the SendBatch request. Would be nil, if Transfer is requested by TransferId, not ClientTransferId and GroupId
 	}
 
 	// PushBatchRequest The request to send a group of push notifications.
@@ -82,8 +105,9 @@ type (
 
 	// Message is a push message
 	Message struct {
-		Android *AndroidMessage `json:"android"` // AndroidMessage with platform-specific properties
-		IOS     *IOSMessage     `json:"iOS"`     // IOSMessage with platform-specific properties
+		Android *AndroidMessage `json:"android"`          // AndroidMessage with platform-specific properties
+		IOS     *IOSMessage     `json:"iOS"`              // IOSMessage with platform-specific properties
+		Huawei  *HuaweiMessage  `json:"huawei,omitempty"` // HuaweiMessage with properties for HMS devices (huawei_push_token, huawei_oaid). If nil, they get the Android section
 	}
 
 	// AndroidMessage with platform-specific properties
@@ -119,6 +143,36 @@ type (
 		Deeplink string `json:"deeplink,omitempty"` // The deeplink with an application screen to take a user to after clicking on a push message.
 	}
 
+	// HuaweiMessage with properties specific for devices with Huawei Mobile Services
+	HuaweiMessage struct {
+		Silent     bool           `json:"silent"`                // A flag that indicates silent push sending. Possible values: true | false.
+		Content    *HuaweiContent `json:"content"`               // The content of the push message.
+		OpenAction *HuaweiAction  `json:"open_action,omitempty"` // The action to be taken when a user clicks on a push notification. If the field is empty, the user click opens the application.
+	}
+
+	// HuaweiContent is the content of the push message for HMS devices.
+	HuaweiContent struct {
+		Title       string `json:"title"`         // The title of the push message. The value is mandatory for non-silent push messages.
+		Text        string `json:"text"`          // The text of the message. The value is mandatory for non-silent push messages.
+		Icon        string `json:"icon"`          // The icon is shown in the notification bar, resource ID in the /res/drawable/ directory of the app. By default, the app icon is displayed.
+		Color       string `json:"color"`         // The color of the message icon in the format of the hex code #RRGGBB.
+		Image       string `json:"image"`         // The URL of the image which is displayed in the push message. HTTPS is required by HMS.
+		Data        string `json:"data"`          // An arbitrary data string, processed by the app like AndroidContent.Data.
+		ChannelID   string `json:"channel_id"`    // ID of the notification channel. Available for EMUI 10 or higher.
+		Importance  string `json:"importance"`    // Importance of the notification. Acceptable values: LOW, NORMAL, HIGH. HIGH requires approval of the HMS message category.
+		Category    string `json:"category"`      // HMS message category, e.g. MARKETING, IM, VOIP, SUBSCRIPTION. It is used by HMS to classify messages and limit marketing ones.
+		CollapseKey int    `json:"collapse_key"`  // Notification ID. A new message with the same ID replaces the displayed one.
+		BadgeClass  string `json:"badge_class"`   // Full class name of the app entry activity, required to change the badge.
+		BadgeAddNum int    `json:"badge_add_num"` // Number added to the badge of the app icon, from 1 to 99.
+		TimeToLive  int    `json:"time_to_live"`  // The duration in seconds HMS keeps the message if the device is offline.
+		Urgency     string `json:"urgency"`       // Urgency of delivery. Acceptable values: high, normal.
+	}
+
+	// HuaweiAction is the action to be taken when a user clicks on a push notification. If the field is empty, the user click opens the application.
+	HuaweiAction struct {
+		Deeplink string `json:"deeplink,omitempty"` // The deeplink with an application screen to take a user to after clicking on a push message.
+	}
+
 	// IOSMessage with platform-specific properties
 	IOSMessage struct {
 		Silent     bool        `json:"silent"`                // A flag that indicates silent push sending. Possible values: true | false.
@@ -0,0 +1,214 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DryRun records requests instead of sending them. Push filters, validation and splitting work as usual,
+// then the final body of every send-batch request is written to Out or to a file in Dir,
+// and a synthetic PushResponse is returned. Only SendPush is intercepted: group management requests go to the API,
+// status requests go to the API unless they are about a recorded request.
+// Push recorders get recorded requests with an error, so frequency caps don't count them.
+// It is turned on by WithDryRun or NewDryRunClient.
+type DryRun struct {
+	Out io.Writer // Out gets every request body as a line of JSON. Ignored if Dir is set
+	Dir string    // Dir gets every request body as a separate file request-000001.json, request-000002.json and so on. It is created on the first write
+
+	mu        sync.Mutex
+	summary   *DryRunSummary
+	transfers map[int]*Transfer
+}
+
+// errDryRun is passed to push recorders, since requests recorded by DryRun are not sent
+var errDryRun = errors.New("push is recorded by dry run")
+
+// DryRunSummary describes all requests recorded by DryRun
+type DryRunSummary struct {
+	Requests []*DryRunRecord // Requests in the order they were recorded
+	Batches  int             // Batches is the number of batches of all requests
+	Devices  map[string]int  // Devices is the number of devices of all requests per IDType
+	Warnings []string        // Warnings of validation of all requests
+}
+
+// DryRunRecord describes a single recorded request
+type DryRunRecord struct {
+	TransferId       int            // TransferId of the synthetic response
+	ClientTransferId int64          // ClientTransferId of the request
+	GroupId          int            // GroupId of the request
+	Tag              string         // Tag of the request
+	File             string         // File the body was written to, empty if it was written to Out
+	Batches          int            // Batches is the number of batches of the request
+	Devices          map[string]int // Devices is the number of devices per IDType
+	PayloadSizes     []PayloadSize  // PayloadSizes are estimated payload sizes of every batch
+}
+
+func NewDryRun(out io.Writer) *DryRun {
+	return &DryRun{Out: out}
+}
+
+func NewDryRunDir(dir string) *DryRun {
+	return &DryRun{Dir: dir}
+}
+
+// WithDryRun is an option to record push requests with DryRun instead of sending them
+func WithDryRun(d *DryRun) ClientOption {
+	return func(c *client) {
+		c.dryRun = d
+	}
+}
+
+// NewDryRunClient is a function to create a client which records push requests with DryRun.
+// Options are applied as in NewClient, e.g. WithPushFilters.
+func NewDryRunClient(token string, d *DryRun, opts ...ClientOption) Client {
+	return NewClient(token, append(opts, WithDryRun(d))...)
+}
+
+// Summary is a method to get the summary of requests recorded so far
+func (d *DryRun) Summary() *DryRunSummary {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.summary == nil {
+		return &DryRunSummary{Requests: make([]*DryRunRecord, 0), Devices: make(map[string]int)}
+	}
+
+	s := *d.summary
+	s.Requests = append([]*DryRunRecord(nil), d.summary.Requests...)
+	s.Warnings = append([]string(nil), d.summary.Warnings...)
+	s.Devices = make(map[string]int, len(d.summary.Devices))
+	for k, v := range d.summary.Devices {
+		s.Devices[k] = v
+	}
+	return &s
+}
+
+// DevicesTotal is a method to get the number of devices of all types
+func (s *DryRunSummary) DevicesTotal() int {
+	n := 0
+	for _, c := range s.Devices {
+		n += c
+	}
+	return n
+}
+
+// record validates and writes the request, then returns a synthetic response
+func (d *DryRun) record(r *PushBatchRequest) (*PushResponse, error) {
+	warnings, err := r.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.summary == nil {
+		d.summary = &DryRunSummary{Requests: make([]*DryRunRecord, 0), Devices: make(map[string]int)}
+		d.transfers = make(map[int]*Transfer)
+	}
+
+	rec := &DryRunRecord{
+		TransferId:       len(d.summary.Requests) + 1,
+		ClientTransferId: r.ClientTransferID,
+		GroupId:          r.GroupID,
+		Tag:              r.Tag,
+		Batches:          len(r.Batch),
+		Devices:          make(map[string]int),
+		PayloadSizes:     make([]PayloadSize, 0, len(r.Batch)),
+	}
+	for _, b := range r.Batch {
+		for _, device := range b.Devices {
+			if device != nil {
+				rec.Devices[device.IDType] += len(device.IDValues)
+			}
+		}
+		rec.PayloadSizes = append(rec.PayloadSizes, EstimatePayloadSize(b.Messages))
+	}
+
+	if err := d.write(rec, r); err != nil {
+		return nil, err
+	}
+
+	d.summary.Requests = append(d.summary.Requests, rec)
+	d.summary.Batches += rec.Batches
+	for idType, n := range rec.Devices {
+		d.summary.Devices[idType] += n
+	}
+	for _, w := range warnings {
+		d.summary.Warnings = append(d.summary.Warnings, fmt.Sprintf("request %d: %s", rec.TransferId, w))
+	}
+
+	clientTransferId := r.ClientTransferID
+	d.transfers[rec.TransferId] = &Transfer{
+		ID:               rec.TransferId,
+		GroupId:          r.GroupID,
+		Status:           TransferStatusSent,
+		Tag:              r.Tag,
+		Errors:           make([]string, 0),
+		ClientTransferId: &clientTransferId,
+	}
+	return &PushResponse{TransferId: rec.TransferId, ClientTransferId: r.ClientTransferID}, nil
+}
+
+func (d *DryRun) write(rec *DryRunRecord, r *PushBatchRequest) error {
+	if d.Dir != "" {
+		if err := os.MkdirAll(d.Dir, 0o755); err != nil {
+			return err
+		}
+		rec.File = filepath.Join(d.Dir, fmt.Sprintf("request-%06d.json", rec.TransferId))
+		f, err := os.Create(rec.File)
+		if err != nil {
+			return err
+		}
+		err = writeRequestLine(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	if d.Out == nil {
+		return nil
+	}
+	return writeRequestLine(d.Out, r)
+}
+
+func writeRequestLine(out io.Writer, r *PushBatchRequest) error {
+	w := bufio.NewWriter(out)
+	if err := encodeRequest(w, &request{PushBatchRequest: r}); err != nil {
+		return err
+	}
+	w.WriteByte('\n')
+	return w.Flush()
+}
+
+// transfer returns the synthetic transfer of a recorded request
+func (d *DryRun) transfer(transferId int) (*Transfer, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t, ok := d.transfers[transferId]
+	if !ok {
+		return nil, false
+	}
+	copied := *t
+	return &copied, true
+}
+
+// transferByClientId returns the synthetic transfer of the last recorded request with clientTransferId
+func (d *DryRun) transferByClientId(groupId int, clientTransferId int64) (*Transfer, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.summary == nil || clientTransferId == 0 {
+		return nil, false
+	}
+	for i := len(d.summary.Requests) - 1; i >= 0; i-- {
+		rec := d.summary.Requests[i]
+		if rec.GroupId == groupId && rec.ClientTransferId == clientTransferId {
+			copied := *d.transfers[rec.TransferId]
+			return &copied, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,100 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func dryRunPush(ids ...string) *PushBatchRequest {
+	r := testPush(IDTypeAppmetricaDeviceID, ids...)
+	r.Batch[0].Messages = &Message{Android: NewAndroidMessage("Title", "Text", false)}
+	return r
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name string
+		dry  func(t *testing.T) (*DryRun, func() [][]byte)
+	}{
+		{"writer", func(t *testing.T) (*DryRun, func() [][]byte) {
+			var out bytes.Buffer
+			return NewDryRun(&out), func() [][]byte {
+				lines := make([][]byte, 0)
+				s := bufio.NewScanner(&out)
+				for s.Scan() {
+					lines = append(lines, append([]byte(nil), s.Bytes()...))
+				}
+				return lines
+			}
+		}},
+		{"directory", func(t *testing.T) (*DryRun, func() [][]byte) {
+			// the directory doesn't exist yet, it is created on the first write
+			dir := filepath.Join(t.TempDir(), "requests", "campaign")
+			return NewDryRunDir(dir), func() [][]byte {
+				files, _ := filepath.Glob(filepath.Join(dir, "request-*.json"))
+				lines := make([][]byte, 0, len(files))
+				for _, file := range files {
+					data, err := os.ReadFile(file)
+					if err != nil {
+						t.Fatal(err)
+					}
+					lines = append(lines, bytes.TrimSpace(data))
+				}
+				return lines
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dryRun, written := tt.dry(t)
+			c := NewDryRunClient("token", dryRun, WithHTTPClient(&http.Client{Transport: &handlerTransport{handler: http.HandlerFunc(failedHandler)}}))
+
+			for _, ids := range [][]string{{"1", "2"}, {"3"}} {
+				res, err := c.SendPush(dryRunPush(ids...))
+				if err != nil {
+					t.Fatal(err)
+				}
+				transfer, err := c.GetStatusByTransferId(res.TransferId)
+				if err != nil || transfer.Status != TransferStatusSent {
+					t.Fatalf("recorded request should be reported as sent, got %+v, %v", transfer, err)
+				}
+			}
+
+			lines := written()
+			if len(lines) != 2 {
+				t.Fatalf("got %d written requests, want 2", len(lines))
+			}
+			for _, line := range lines {
+				var body request
+				if err := json.Unmarshal(line, &body); err != nil || body.PushBatchRequest.GroupID != 1 {
+					t.Fatalf("written request %s is not a send-batch body: %v", line, err)
+				}
+			}
+
+			summary := dryRun.Summary()
+			if len(summary.Requests) != 2 || summary.Batches != 2 || summary.DevicesTotal() != 3 || summary.Devices[IDTypeAppmetricaDeviceID] != 3 {
+				t.Fatalf("unexpected summary %+v", summary)
+			}
+			if rec := summary.Requests[0]; rec.TransferId != 1 || rec.Devices[IDTypeAppmetricaDeviceID] != 2 || (dryRun.Dir != "") != (rec.File != "") {
+				t.Fatalf("unexpected record %+v", rec)
+			}
+		})
+	}
+}
+
+func TestDryRunRefusesInvalidRequest(t *testing.T) {
+	dryRun := NewDryRun(nil)
+	r := dryRunPush("1")
+	r.Tag = ""
+	if _, err := NewDryRunClient("token", dryRun).SendPush(r); err == nil {
+		t.Fatal("invalid request should not be recorded")
+	}
+	if n := len(dryRun.Summary().Requests); n != 0 {
+		t.Fatalf("got %d recorded requests", n)
+	}
+}
@@ -0,0 +1,160 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// encodeBufferSize is the size of buffered writer used by streaming encoder
+const encodeBufferSize = 32 * 1024
+
+var writerPool = sync.Pool{
+	New: func() any {
+		return bufio.NewWriterSize(nil, encodeBufferSize)
+	},
+}
+
+// streamRequest returns a reader of req encoded as JSON. The body is encoded in background
+// while it is read, so a large send-batch request is never held in memory as a whole.
+func streamRequest(req *request) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		bw := writerPool.Get().(*bufio.Writer)
+		bw.Reset(pw)
+		err := encodeRequest(bw, req)
+		if err == nil {
+			err = bw.Flush()
+		}
+		bw.Reset(nil)
+		writerPool.Put(bw)
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// encodeRequest writes req to w producing the same JSON as json.Marshal.
+// Device ids of send-batch request are written one by one instead of building the whole payload.
+func encodeRequest(w *bufio.Writer, req *request) error {
+	if req.PushBatchRequest == nil {
+		return json.NewEncoder(w).Encode(req)
+	}
+
+	p := req.PushBatchRequest
+	w.WriteString(`{"push_batch_request":{"group_id":`)
+	w.WriteString(strconv.Itoa(p.GroupID))
+	w.WriteString(`,"client_transfer_id":`)
+	w.WriteString(strconv.FormatInt(p.ClientTransferID, 10))
+	w.WriteString(`,"tag":`)
+	if err := writeJSONString(w, p.Tag); err != nil {
+		return err
+	}
+	w.WriteString(`,"batch":`)
+	if p.Batch == nil {
+		w.WriteString("null")
+	} else {
+		w.WriteByte('[')
+		for i, b := range p.Batch {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := encodeBatch(w, b); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	}
+	w.WriteByte('}')
+	if req.Group != nil {
+		w.WriteString(`,"group":`)
+		g, err := json.Marshal(req.Group)
+		if err != nil {
+			return err
+		}
+		w.Write(g)
+	}
+	_, err := w.WriteString("}")
+	return err
+}
+
+func encodeBatch(w *bufio.Writer, b *Batch) error {
+	if b == nil {
+		_, err := w.WriteString("null")
+		return err
+	}
+
+	w.WriteString(`{"messages":`)
+	m, err := json.Marshal(b.Messages)
+	if err != nil {
+		return err
+	}
+	w.Write(m)
+
+	w.WriteString(`,"devices":`)
+	if b.Devices == nil {
+		w.WriteString("null")
+	} else {
+		w.WriteByte('[')
+		for i, d := range b.Devices {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := encodeDevice(w, d); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	}
+	_, err = w.WriteString("}")
+	return err
+}
+
+func encodeDevice(w *bufio.Writer, d *Device) error {
+	if d == nil {
+		_, err := w.WriteString("null")
+		return err
+	}
+
+	w.WriteString(`{"id_type":`)
+	if err := writeJSONString(w, d.IDType); err != nil {
+		return err
+	}
+	w.WriteString(`,"id_values":`)
+	if d.IDValues == nil {
+		w.WriteString("null")
+	} else {
+		w.WriteByte('[')
+		for i, id := range d.IDValues {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if err := writeJSONString(w, id); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(']')
+	}
+	_, err := w.WriteString("}")
+	return err
+}
+
+// writeJSONString writes s as JSON string. Push tokens and device ids are plain ASCII,
+// so they are written as is and only other strings go through json.Marshal.
+func writeJSONString(w *bufio.Writer, s string) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x80 || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			b, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		}
+	}
+	w.WriteByte('"')
+	w.WriteString(s)
+	return w.WriteByte('"')
+}
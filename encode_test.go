@@ -0,0 +1,79 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+)
+
+func benchRequest(devices int) *request {
+	ids := make([]string, devices)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%064x", i)
+	}
+	return &request{PushBatchRequest: &PushBatchRequest{
+		GroupID:          1,
+		ClientTransferID: 42,
+		Tag:              "promo",
+		Batch: []*Batch{{
+			Messages: &Message{Android: NewAndroidMessage("Title", "Text", false), IOS: NewIOSMessage("Title", "Text", false)},
+			Devices:  []*Device{NewDevice(IDTypeIOSPushToken, ids...)},
+		}},
+	}}
+}
+
+func TestEncodeRequestMatchesMarshal(t *testing.T) {
+	requests := []*request{
+		benchRequest(3),
+		{PushBatchRequest: &PushBatchRequest{Tag: "<b>\"quoted\" & ünïcode</b>\n", Batch: []*Batch{nil, {Devices: []*Device{nil, {IDType: IDTypeGoogleAID}}}}}},
+		{PushBatchRequest: &PushBatchRequest{GroupID: 7}, Group: &Group{ID: 7, Name: "group"}},
+	}
+	for i, req := range requests {
+		want, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		if err := encodeRequest(w, req); err != nil {
+			t.Fatal(err)
+		}
+		w.Flush()
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("request %d:\n got %s\nwant %s", i, buf.Bytes(), want)
+		}
+
+		streamed, err := io.ReadAll(streamRequest(req))
+		if err != nil || !bytes.Equal(streamed, want) {
+			t.Errorf("streamed request %d differs: %v", i, err)
+		}
+	}
+}
+
+func BenchmarkEncodeRequest(b *testing.B) {
+	for _, devices := range []int{10000, 100000, 250000} {
+		req := benchRequest(devices)
+		b.Run("marshal/"+strconv.Itoa(devices), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				data, err := json.Marshal(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				io.Copy(io.Discard, bytes.NewReader(data))
+			}
+		})
+		b.Run("stream/"+strconv.Itoa(devices), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := io.Copy(io.Discard, streamRequest(req)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package appmetrica_push
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Variant is a message variant of Experiment
+type Variant struct {
+	Name    string   // Name of the variant. It is added to the tag of requests of the variant
+	Weight  int      // Weight of the variant relative to other variants, e.g. 1 and 1 for 50/50 or 9 and 1 for 90/10
+	Message *Message // Message sent to devices assigned to the variant
+}
+
+// Experiment assigns every device of an audience to one of its variants. The assignment depends only on the device id
+// and Salt, so the same device gets the same variant every time the experiment is split.
+type Experiment struct {
+	Name       string     // Name of the experiment
+	Salt       string     // Salt of hashing. Default is Name. Change it to reshuffle the audience
+	Variants   []*Variant // Variants of the experiment
+	MaxDevices int        // MaxDevices in one request. Default is MaxDevicesPerRequest
+}
+
+// ExperimentAssignment maps device ids of every IDType to names of variants they were assigned to
+type ExperimentAssignment map[string]map[string]string
+
+func NewExperiment(name string, variants ...*Variant) *Experiment {
+	return &Experiment{Name: name, Salt: name, Variants: variants, MaxDevices: MaxDevicesPerRequest}
+}
+
+func NewVariant(name string, weight int, message *Message) *Variant {
+	return &Variant{Name: name, Weight: weight, Message: message}
+}
+
+// Validate is a method to check that variants have unique names, messages and positive total weight
+func (e *Experiment) Validate() error {
+	if len(e.Variants) == 0 {
+		return errors.New("experiment has no variants")
+	}
+	names := make(map[string]bool, len(e.Variants))
+	total := 0
+	for _, v := range e.Variants {
+		if v == nil || v.Name == "" {
+			return errors.New("variant name is required")
+		}
+		if names[v.Name] {
+			return fmt.Errorf("variant %q is duplicated", v.Name)
+		}
+		names[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %q has negative weight", v.Name)
+		}
+		if v.Message == nil {
+			return fmt.Errorf("variant %q has no message", v.Name)
+		}
+		total += v.Weight
+	}
+	if total <= 0 {
+		return errors.New("total weight of variants should be positive")
+	}
+	return nil
+}
+
+// Assign is a method to get the variant of the device. Ids are normalized before hashing,
+// so the same device gets the same variant regardless of case and whitespace.
+func (e *Experiment) Assign(idType string, id string) *Variant {
+	total := 0
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return nil
+	}
+
+	point := deviceHash(hashDomainExperiment, e.salt(), idType, id) % uint64(total)
+	for _, v := range e.Variants {
+		if point < uint64(v.Weight) {
+			return v
+		}
+		point -= uint64(v.Weight)
+	}
+	return nil
+}
+
+// VariantTag is a method to get the tag of requests of the variant, e.g. "sale_b" for tag "sale" and variant "b".
+// Every variant gets its own tag, so AppMetrica reports show them separately.
+func (e *Experiment) VariantTag(tag string, v *Variant) string {
+	return tag + "_" + v.Name
+}
+
+// Split is a method to assign devices to variants and build requests for every variant.
+// Requests of a variant have one Batch with the message of the variant and the tag from VariantTag.
+// The returned assignment can be joined with analytics later.
+func (e *Experiment) Split(groupId int, tag string, devices []*Device) ([]*PushBatchRequest, ExperimentAssignment, error) {
+	if err := e.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	assignment := make(ExperimentAssignment)
+	byVariant := make(map[*Variant][]*Device, len(e.Variants))
+	byType := make(map[*Variant]map[string]*Device, len(e.Variants))
+	for _, d := range devices {
+		if d == nil {
+			continue
+		}
+		for _, id := range d.IDValues {
+			v := e.Assign(d.IDType, id)
+			if byType[v] == nil {
+				byType[v] = make(map[string]*Device)
+			}
+			device, ok := byType[v][d.IDType]
+			if !ok {
+				device = NewDevice(d.IDType)
+				byType[v][d.IDType] = device
+				byVariant[v] = append(byVariant[v], device)
+			}
+			device.IDValues = append(device.IDValues, id)
+
+			if assignment[d.IDType] == nil {
+				assignment[d.IDType] = make(map[string]string)
+			}
+			assignment[d.IDType][id] = v.Name
+		}
+	}
+
+	requests := make([]*PushBatchRequest, 0, len(e.Variants))
+	for _, v := range e.Variants {
+		splitter := NewBatchSplitter(groupId, e.VariantTag(tag, v), v.Message)
+		splitter.MaxDevices = e.MaxDevices
+		requests = append(requests, splitter.SplitDevices(byVariant[v])...)
+	}
+	return requests, assignment, nil
+}
+
+// Variant is a method to get the name of the variant the device was assigned to, empty if it wasn't assigned
+func (a ExperimentAssignment) Variant(idType string, id string) string {
+	return a[idType][id]
+}
+
+// Counts is a method to get the number of devices assigned to every variant
+func (a ExperimentAssignment) Counts() map[string]int {
+	counts := make(map[string]int)
+	for _, ids := range a {
+		for _, variant := range ids {
+			counts[variant]++
+		}
+	}
+	return counts
+}
+
+func (e *Experiment) salt() string {
+	if e.Salt == "" {
+		return e.Name
+	}
+	return e.Salt
+}
+
+// Domains of deviceHash, so experiments and holdouts with the same salt split the audience independently
+const (
+	hashDomainExperiment = "experiment"
+	hashDomainHoldout    = "holdout"
+)
+
+// deviceHash is a stable hash of the normalized device id, so the same device always falls into the same bucket.
+// SHA-256 is used since low bits of simpler hashes follow the last characters of sequential ids.
+func deviceHash(domain string, salt string, idType string, id string) uint64 {
+	h := sha256.New()
+	h.Write([]byte(domain))
+	h.Write([]byte{0})
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(idType))
+	h.Write([]byte{0})
+	h.Write([]byte(deviceKey(idType, id)))
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
@@ -0,0 +1,111 @@
+package appmetrica_push
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestExperimentValidate(t *testing.T) {
+	m := &Message{}
+	tests := []struct {
+		name     string
+		variants []*Variant
+		ok       bool
+	}{
+		{"valid", []*Variant{NewVariant("a", 1, m), NewVariant("b", 0, m)}, true},
+		{"no variants", nil, false},
+		{"nil variant", []*Variant{nil}, false},
+		{"duplicated name", []*Variant{NewVariant("a", 1, m), NewVariant("a", 1, m)}, false},
+		{"negative weight", []*Variant{NewVariant("a", 2, m), NewVariant("b", -1, m)}, false},
+		{"zero total weight", []*Variant{NewVariant("a", 0, m), NewVariant("b", 0, m)}, false},
+		{"no message", []*Variant{NewVariant("a", 1, nil)}, false},
+	}
+	for _, tt := range tests {
+		if err := NewExperiment("exp", tt.variants...).Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: got %v", tt.name, err)
+		}
+	}
+}
+
+func TestExperimentWeights(t *testing.T) {
+	const devices = 20000
+	tests := []struct {
+		name    string
+		weights []int
+	}{
+		{"even", []int{1, 1}},
+		{"90/10", []int{9, 1}},
+		{"three-way", []int{1, 2, 1}},
+		{"zero weight", []int{1, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExperiment("exp")
+			total := 0
+			for i, w := range tt.weights {
+				e.Variants = append(e.Variants, NewVariant(strconv.Itoa(i), w, &Message{}))
+				total += w
+			}
+			counts := make(map[string]int)
+			for i := 0; i < devices; i++ {
+				counts[e.Assign(IDTypeAppmetricaDeviceID, strconv.Itoa(i)).Name]++
+			}
+			for i, w := range tt.weights {
+				want := float64(devices) * float64(w) / float64(total)
+				got := float64(counts[strconv.Itoa(i)])
+				if got < want*0.95-1 || got > want*1.05+1 {
+					t.Errorf("variant %d of weight %d got %v devices, want about %v", i, w, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestExperimentAssignIsStable(t *testing.T) {
+	e := NewExperiment("exp", NewVariant("a", 1, &Message{}), NewVariant("b", 1, &Message{}))
+	token := "0A1B2C3D0A1B2C3D"
+	for i := 0; i < 100; i++ {
+		id := token + strconv.Itoa(i)
+		if e.Assign(IDTypeIOSPushToken, id) != e.Assign(IDTypeIOSPushToken, " "+id+" ") {
+			t.Fatalf("%s: assignment depends on whitespace", id)
+		}
+	}
+
+	none := NewExperiment("exp", NewVariant("a", 0, &Message{}))
+	if v := none.Assign(IDTypeAppmetricaDeviceID, "1"); v != nil {
+		t.Fatalf("experiment without weights assigned %q", v.Name)
+	}
+}
+
+func TestExperimentSplit(t *testing.T) {
+	a := NewVariant("a", 1, &Message{})
+	b := NewVariant("b", 1, &Message{})
+	e := NewExperiment("exp", a, b)
+	ids := make([]string, 0)
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, strconv.Itoa(i))
+	}
+
+	requests, assignment, err := e.Split(1, "sale", []*Device{NewDevice(IDTypeAppmetricaDeviceID, ids...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := assignment.Counts()
+	if len(requests) != 2 || counts["a"]+counts["b"] != len(ids) {
+		t.Fatalf("got %d requests, counts %v", len(requests), counts)
+	}
+	for _, r := range requests {
+		v := a
+		if r.Tag == "sale_b" {
+			v = b
+		}
+		if r.Batch[0].Messages != v.Message || countDevices(r.Batch[0].Devices) != counts[v.Name] {
+			t.Fatalf("request %s doesn't match variant %s", r.Tag, v.Name)
+		}
+		for _, id := range r.Batch[0].Devices[0].IDValues {
+			if assignment.Variant(IDTypeAppmetricaDeviceID, id) != v.Name {
+				t.Fatalf("device %s is sent %s but assigned to another variant", id, r.Tag)
+			}
+		}
+	}
+}
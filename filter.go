@@ -0,0 +1,144 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrEmptyPush is returned by SendPush when push filters removed all devices of the request.
+// It is an expected outcome rather than a failure, BatchSender reports such requests as skipped.
+var ErrEmptyPush = errors.New("no devices left to send push to")
+
+// PushFilter changes the request before it is sent, e.g. removes suppressed devices.
+// Filters are set with WithPushFilters and get a copy of the request passed to SendPush,
+// so they can change devices of the request in place. Returned error cancels sending.
+type PushFilter interface {
+	FilterPush(ctx context.Context, r *PushBatchRequest) error
+}
+
+// PushRecorder is implemented by push filters which need the outcome of sending, e.g. to count sends.
+// RecordPush gets the filtered request after SendPush is done, or with the error if sending was cancelled
+// by a filter, or if the request was recorded by the dry run or redirected to QA devices,
+// so reservations made by FilterPush can be released.
+type PushRecorder interface {
+	RecordPush(ctx context.Context, r *PushBatchRequest, res *PushResponse, err error)
+}
+
+// PushFilterFunc is an adapter to use ordinary function as PushFilter
+type PushFilterFunc func(ctx context.Context, r *PushBatchRequest) error
+
+func (f PushFilterFunc) FilterPush(ctx context.Context, r *PushBatchRequest) error {
+	return f(ctx, r)
+}
+
+// filterPush passes a copy of the request through filters of the client and drops batches left without devices
+func (c client) filterPush(ctx context.Context, r *PushBatchRequest) (*PushBatchRequest, error) {
+	if len(c.filters) == 0 || r == nil {
+		return r, nil
+	}
+
+	r = cloneRequest(r)
+	for _, f := range c.filters {
+		err := f.FilterPush(ctx, r)
+		if err == nil {
+			dropEmptyBatches(r)
+			if len(r.Batch) == 0 {
+				err = ErrEmptyPush
+			}
+		}
+		if err != nil {
+			c.recordPush(ctx, r, nil, err)
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// recordPush passes the outcome of sending to filters implementing PushRecorder
+func (c client) recordPush(ctx context.Context, r *PushBatchRequest, res *PushResponse, err error) {
+	for _, f := range c.filters {
+		if rec, ok := f.(PushRecorder); ok {
+			rec.RecordPush(ctx, r, res, err)
+		}
+	}
+}
+
+// filterDevices keeps ids of the request for which keep returns true and removes the rest in place.
+// Devices and batches left without ids are removed, the number of removed batches is returned.
+// It stops on the first error of keep.
+func filterDevices(r *PushBatchRequest, keep func(idType string, id string) (bool, error)) (int, error) {
+	for _, b := range r.Batch {
+		if b == nil {
+			continue
+		}
+		for _, d := range b.Devices {
+			if d == nil {
+				continue
+			}
+			ids := d.IDValues[:0]
+			for _, id := range d.IDValues {
+				ok, err := keep(d.IDType, id)
+				if err != nil {
+					return 0, err
+				}
+				if ok {
+					ids = append(ids, id)
+				}
+			}
+			d.IDValues = ids
+		}
+		b.Devices = withoutEmptyDevices(b.Devices)
+	}
+	return dropEmptyBatches(r), nil
+}
+
+func forEachDevice(r *PushBatchRequest, fn func(idType string, id string)) {
+	for _, b := range r.Batch {
+		if b == nil {
+			continue
+		}
+		for _, d := range b.Devices {
+			if d == nil {
+				continue
+			}
+			for _, id := range d.IDValues {
+				fn(d.IDType, id)
+			}
+		}
+	}
+}
+
+// inScope reports whether the request has one of tags and one of groups. Empty tags or groups match any request.
+func inScope(r *PushBatchRequest, tags []string, groups []int) bool {
+	if len(tags) > 0 && !containsString(tags, r.Tag) {
+		return false
+	}
+	if len(groups) > 0 && !containsInt(groups, r.GroupID) {
+		return false
+	}
+	return true
+}
+
+// cloneRequest copies the request with its batches and device lists. Messages are shared with the original request.
+func cloneRequest(r *PushBatchRequest) *PushBatchRequest {
+	clone := *r
+	clone.Batch = make([]*Batch, 0, len(r.Batch))
+	for _, b := range r.Batch {
+		if b == nil {
+			continue
+		}
+		batch := *b
+		batch.Devices = make([]*Device, 0, len(b.Devices))
+		for _, d := range b.Devices {
+			if d == nil {
+				continue
+			}
+			batch.Devices = append(batch.Devices, &Device{
+				IDType:   d.IDType,
+				IDValues: append([]string(nil), d.IDValues...),
+			})
+		}
+		clone.Batch = append(clone.Batch, &batch)
+	}
+	return &clone
+}
@@ -0,0 +1,525 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FrequencyCap limits the number of pushes a device gets within Period,
+// e.g. no more than 3 pushes per 24 hours or at most 1 push per tag per day
+type FrequencyCap struct {
+	Limit    int           // Limit of pushes within Period
+	Period   time.Duration // Period the pushes are counted in
+	PerTag   bool          // PerTag counts pushes of every tag separately
+	PerGroup bool          // PerGroup counts pushes of every group separately
+	Tags     []string      // Tags the cap applies to. Empty means every tag
+	Groups   []int         // Groups the cap applies to. Empty means every group
+}
+
+// FrequencyStore records sends of devices. Keys are built by FrequencyCapper from the device and the cap.
+type FrequencyStore interface {
+	// Reserve records a send for key at the given time if it doesn't exceed any of the caps,
+	// i.e. every cap has less than Limit sends recorded within Period before at. Only Limit and Period of caps are used.
+	// The check and the record must be atomic, since several requests can be filtered concurrently.
+	// The record can be evicted after ttl.
+	Reserve(key string, at time.Time, ttl time.Duration, caps []*FrequencyCap) (bool, error)
+	// Release removes a send recorded for key at the given time, e.g. when the push was not sent
+	Release(key string, at time.Time) error
+	// Add records a send for key at the given time without checks. The record can be evicted after ttl.
+	Add(key string, at time.Time, ttl time.Duration) error
+}
+
+// FrequencyReport describes devices removed from a request by FrequencyCapper
+type FrequencyReport struct {
+	Total          int            // Total number of devices checked
+	Capped         map[string]int // Capped is the number of removed devices per IDType
+	DroppedBatches int            // DroppedBatches is the number of batches left without devices and removed from the request
+}
+
+// FrequencyCapper removes devices which reached any of the caps from requests and reserves sends of the remaining ones,
+// so concurrent requests can't exceed the caps. It implements PushFilter and PushRecorder:
+// with WithPushFilters reservations are kept when SendPush succeeds and released when it fails.
+type FrequencyCapper struct {
+	Store    FrequencyStore                                     // Store of recorded sends
+	Caps     []*FrequencyCap                                    // Caps checked for every request
+	Now      func() time.Time                                   // Now is the clock. Default is time.Now
+	OnReport func(r *PushBatchRequest, report *FrequencyReport) // OnReport is called by FilterPush for every filtered request
+
+	mu       sync.Mutex
+	reserved map[*PushBatchRequest][]*frequencyReservation
+}
+
+// frequencyReservation is a send reserved by Filter for a device
+type frequencyReservation struct {
+	idType string
+	id     string
+	keys   []string
+	at     time.Time
+}
+
+// MemoryFrequencyStore is FrequencyStore kept in memory. It is safe for concurrent use.
+type MemoryFrequencyStore struct {
+	mu      sync.Mutex
+	records map[string][]frequencyRecord
+}
+
+// FileFrequencyStore is MemoryFrequencyStore which appends every record to a file
+// and loads unexpired records from it on open. Use Compact to drop expired records from the file.
+// Only one process should use the file at a time.
+type FileFrequencyStore struct {
+	*MemoryFrequencyStore
+
+	path   string
+	fileMu sync.Mutex
+	file   *os.File
+}
+
+type frequencyRecord struct {
+	At      time.Time
+	Expires time.Time
+}
+
+// frequencyLine is a record of FileFrequencyStore file
+type frequencyLine struct {
+	Key      string `json:"k"`
+	At       int64  `json:"t"`
+	Expires  int64  `json:"e,omitempty"`
+	Released bool   `json:"r,omitempty"` // Released marks removal of the record of Key at At
+}
+
+func NewFrequencyCapper(store FrequencyStore, caps ...*FrequencyCap) *FrequencyCapper {
+	return &FrequencyCapper{Store: store, Caps: caps, Now: time.Now}
+}
+
+func NewMemoryFrequencyStore() *MemoryFrequencyStore {
+	return &MemoryFrequencyStore{records: make(map[string][]frequencyRecord)}
+}
+
+// OpenFileFrequencyStore is a function to open the store at path, creating the file if it doesn't exist
+func OpenFileFrequencyStore(path string) (*FileFrequencyStore, error) {
+	s := &FileFrequencyStore{MemoryFrequencyStore: NewMemoryFrequencyStore(), path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+// Filter is a method to remove devices which reached any of the caps from the request in place
+// and reserve a send for every remaining device. Batches left without devices are removed from the request.
+// Reservations are kept by Record and dropped by Release, one of them should be called with the same request.
+func (f *FrequencyCapper) Filter(r *PushBatchRequest) (*FrequencyReport, error) {
+	report := &FrequencyReport{Capped: make(map[string]int)}
+	caps := f.capsFor(r)
+	now := f.now()
+	reservations := make([]*frequencyReservation, 0)
+
+	dropped, err := filterDevices(r, func(idType string, id string) (bool, error) {
+		report.Total++
+		res, err := f.reserve(caps, r, idType, id, now)
+		if err != nil || res == nil {
+			if err == nil {
+				report.Capped[idType]++
+			}
+			return false, err
+		}
+		if len(res.keys) > 0 {
+			reservations = append(reservations, res)
+		}
+		return true, nil
+	})
+	if err != nil {
+		f.release(reservations)
+		return nil, err
+	}
+	report.DroppedBatches = dropped
+
+	if len(reservations) > 0 {
+		f.mu.Lock()
+		if f.reserved == nil {
+			f.reserved = make(map[*PushBatchRequest][]*frequencyReservation)
+		}
+		f.reserved[r] = append(f.reserved[r], reservations...)
+		f.mu.Unlock()
+	}
+	return report, nil
+}
+
+// Record is a method to keep sends reserved by Filter for devices of the request.
+// Reservations of devices removed from the request after Filter are released.
+// If the request wasn't filtered, a send is recorded to every device of the request.
+func (f *FrequencyCapper) Record(r *PushBatchRequest) error {
+	if reservations, ok := f.takeReserved(r); ok {
+		sent := make(map[string]bool)
+		forEachDevice(r, func(idType string, id string) {
+			sent[idType+":"+id] = true
+		})
+		unsent := make([]*frequencyReservation, 0)
+		for _, res := range reservations {
+			if !sent[res.idType+":"+res.id] {
+				unsent = append(unsent, res)
+			}
+		}
+		return f.release(unsent)
+	}
+
+	caps := f.capsFor(r)
+	if len(caps) == 0 {
+		return nil
+	}
+	now := f.now()
+	var err error
+	forEachDevice(r, func(idType string, id string) {
+		for key, scope := range capsByKey(caps, r, idType, id) {
+			if err == nil {
+				err = f.Store.Add(key, now, scope.period)
+			}
+		}
+	})
+	return err
+}
+
+// Release is a method to drop sends reserved by Filter for devices of the request, e.g. when it wasn't sent
+func (f *FrequencyCapper) Release(r *PushBatchRequest) error {
+	reservations, _ := f.takeReserved(r)
+	return f.release(reservations)
+}
+
+func (f *FrequencyCapper) FilterPush(_ context.Context, r *PushBatchRequest) error {
+	report, err := f.Filter(r)
+	if err != nil {
+		return err
+	}
+	if f.OnReport != nil {
+		f.OnReport(r, report)
+	}
+	return nil
+}
+
+// RecordPush keeps reserved sends of the request if it was sent successfully and releases them otherwise.
+// Errors of the store are ignored, since the outcome of the push is already known.
+func (f *FrequencyCapper) RecordPush(_ context.Context, r *PushBatchRequest, _ *PushResponse, err error) {
+	if err == nil {
+		_ = f.Record(r)
+	} else {
+		_ = f.Release(r)
+	}
+}
+
+// CappedTotal is a method to get the number of removed devices of all types
+func (r *FrequencyReport) CappedTotal() int {
+	n := 0
+	for _, c := range r.Capped {
+		n += c
+	}
+	return n
+}
+
+func (f *FrequencyCapper) capsFor(r *PushBatchRequest) []*FrequencyCap {
+	caps := make([]*FrequencyCap, 0, len(f.Caps))
+	for _, c := range f.Caps {
+		if inScope(r, c.Tags, c.Groups) {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// reserve reserves a send of the device for every counter of the caps. It returns nil if any of the caps is reached.
+func (f *FrequencyCapper) reserve(caps []*FrequencyCap, r *PushBatchRequest, idType string, id string, now time.Time) (*frequencyReservation, error) {
+	res := &frequencyReservation{idType: idType, id: id, at: now}
+	for key, scope := range capsByKey(caps, r, idType, id) {
+		ok, err := f.Store.Reserve(key, now, scope.period, scope.caps)
+		if err != nil || !ok {
+			if releaseErr := f.release([]*frequencyReservation{res}); err == nil {
+				err = releaseErr
+			}
+			return nil, err
+		}
+		res.keys = append(res.keys, key)
+	}
+	return res, nil
+}
+
+func (f *FrequencyCapper) release(reservations []*frequencyReservation) error {
+	var err error
+	for _, res := range reservations {
+		for _, key := range res.keys {
+			if releaseErr := f.Store.Release(key, res.at); err == nil {
+				err = releaseErr
+			}
+		}
+	}
+	return err
+}
+
+func (f *FrequencyCapper) takeReserved(r *PushBatchRequest) ([]*frequencyReservation, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reservations, ok := f.reserved[r]
+	delete(f.reserved, r)
+	return reservations, ok
+}
+
+// frequencyScope is the caps sharing a counter, the counter is kept for the longest period of them
+type frequencyScope struct {
+	caps   []*FrequencyCap
+	period time.Duration
+}
+
+func capsByKey(caps []*FrequencyCap, r *PushBatchRequest, idType string, id string) map[string]*frequencyScope {
+	scopes := make(map[string]*frequencyScope, len(caps))
+	for _, c := range caps {
+		key := c.key(r, idType, id)
+		scope := scopes[key]
+		if scope == nil {
+			scope = &frequencyScope{}
+			scopes[key] = scope
+		}
+		scope.caps = append(scope.caps, c)
+		if c.Period > scope.period {
+			scope.period = c.Period
+		}
+	}
+	return scopes
+}
+
+func (f *FrequencyCapper) now() time.Time {
+	if f.Now == nil {
+		return time.Now()
+	}
+	return f.Now()
+}
+
+// key identifies the counter of the device in the scope of the cap
+func (c *FrequencyCap) key(r *PushBatchRequest, idType string, id string) string {
+	key := idType + ":" + deviceKey(idType, id)
+	if c.PerTag {
+		key += "|tag=" + r.Tag
+	}
+	if c.PerGroup {
+		key += "|group=" + strconv.Itoa(r.GroupID)
+	}
+	return key
+}
+
+func (s *MemoryFrequencyStore) Count(key string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, rec := range s.records[key] {
+		if rec.At.After(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryFrequencyStore) Reserve(key string, at time.Time, ttl time.Duration, caps []*FrequencyCap) (bool, error) {
+	return s.reserve(key, frequencyRecord{At: at, Expires: at.Add(ttl)}, caps), nil
+}
+
+func (s *MemoryFrequencyStore) Release(key string, at time.Time) error {
+	s.release(key, at)
+	return nil
+}
+
+func (s *MemoryFrequencyStore) Add(key string, at time.Time, ttl time.Duration) error {
+	s.add(key, frequencyRecord{At: at, Expires: at.Add(ttl)})
+	return nil
+}
+
+// Evict is a method to drop records expired before now
+func (s *MemoryFrequencyStore) Evict(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, records := range s.records {
+		if alive := unexpired(records, now); len(alive) > 0 {
+			s.records[key] = alive
+		} else {
+			delete(s.records, key)
+		}
+	}
+}
+
+func (s *MemoryFrequencyStore) add(key string, rec frequencyRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addLocked(key, rec)
+}
+
+func (s *MemoryFrequencyStore) addLocked(key string, rec frequencyRecord) {
+	// expired records of the key are evicted on every add, so hot keys don't grow
+	s.records[key] = append(unexpired(s.records[key], rec.At), rec)
+}
+
+func (s *MemoryFrequencyStore) reserve(key string, rec frequencyRecord, caps []*FrequencyCap) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range caps {
+		n := 0
+		since := rec.At.Add(-c.Period)
+		for _, r := range s.records[key] {
+			if r.At.After(since) {
+				n++
+			}
+		}
+		if n >= c.Limit {
+			return false
+		}
+	}
+	s.addLocked(key, rec)
+	return true
+}
+
+func (s *MemoryFrequencyStore) release(key string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := s.records[key]
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].At.Equal(at) {
+			s.records[key] = append(records[:i:i], records[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reserve, Release and Add hold fileMu while changing the records and writing the line,
+// so Compact never rewrites the file between the two and the line is never written twice
+func (s *FileFrequencyStore) Reserve(key string, at time.Time, ttl time.Duration, caps []*FrequencyCap) (bool, error) {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	rec := frequencyRecord{At: at, Expires: at.Add(ttl)}
+	if !s.MemoryFrequencyStore.reserve(key, rec, caps) {
+		return false, nil
+	}
+	return true, s.write(&frequencyLine{Key: key, At: rec.At.UnixNano(), Expires: rec.Expires.UnixNano()})
+}
+
+func (s *FileFrequencyStore) Release(key string, at time.Time) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	s.MemoryFrequencyStore.release(key, at)
+	return s.write(&frequencyLine{Key: key, At: at.UnixNano(), Released: true})
+}
+
+func (s *FileFrequencyStore) Add(key string, at time.Time, ttl time.Duration) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	rec := frequencyRecord{At: at, Expires: at.Add(ttl)}
+	s.MemoryFrequencyStore.add(key, rec)
+	return s.write(&frequencyLine{Key: key, At: rec.At.UnixNano(), Expires: rec.Expires.UnixNano()})
+}
+
+// write appends the line to the file. s.fileMu must be held.
+func (s *FileFrequencyStore) write(l *frequencyLine) error {
+	line, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Compact is a method to evict records expired before now and rewrite the file with the remaining ones
+func (s *FileFrequencyStore) Compact(now time.Time) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+
+	s.Evict(now)
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	s.mu.Lock()
+	for key, records := range s.records {
+		for _, rec := range records {
+			if err == nil {
+				err = enc.Encode(&frequencyLine{Key: key, At: rec.At.UnixNano(), Expires: rec.Expires.UnixNano()})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	return err
+}
+
+// Close is a method to close the file of the store
+func (s *FileFrequencyStore) Close() error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileFrequencyStore) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var l frequencyLine
+		// a line can be cut if the process crashed while writing it, losing one record is fine
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			continue
+		}
+		rec := frequencyRecord{At: time.Unix(0, l.At), Expires: time.Unix(0, l.Expires)}
+		if l.Released {
+			s.MemoryFrequencyStore.release(l.Key, rec.At)
+			continue
+		}
+		if rec.Expires.After(now) {
+			s.records[l.Key] = append(s.records[l.Key], rec)
+		}
+	}
+	return scanner.Err()
+}
+
+func unexpired(records []frequencyRecord, now time.Time) []frequencyRecord {
+	alive := records[:0]
+	for _, rec := range records {
+		if rec.Expires.After(now) {
+			alive = append(alive, rec)
+		}
+	}
+	return alive
+}
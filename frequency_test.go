@@ -0,0 +1,151 @@
+package appmetrica_push
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFrequencyCapperConcurrentSends(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	capper := NewFrequencyCapper(NewMemoryFrequencyStore(), &FrequencyCap{Limit: 1, Period: time.Hour})
+	capper.Now = func() time.Time { return now }
+
+	var delivered int32
+	c := newTestClient(sentHandler, WithPushFilters(capper))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.SendPush(testPush(IDTypeAppmetricaDeviceID, "42")); err == nil {
+				atomic.AddInt32(&delivered, 1)
+			} else if !errors.Is(err, ErrEmptyPush) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if delivered != 1 {
+		t.Fatalf("cap of 1 push delivered %d pushes", delivered)
+	}
+}
+
+func TestFrequencyCapperReleasesFailedSend(t *testing.T) {
+	capper := NewFrequencyCapper(NewMemoryFrequencyStore(), &FrequencyCap{Limit: 1, Period: time.Hour})
+
+	if _, err := newTestClient(failedHandler, WithPushFilters(capper)).SendPush(testPush(IDTypeAppmetricaDeviceID, "42")); err == nil {
+		t.Fatal("send should fail")
+	}
+	if _, err := newTestClient(sentHandler, WithPushFilters(capper)).SendPush(testPush(IDTypeAppmetricaDeviceID, "42")); err != nil {
+		t.Fatalf("failed send should not count: %v", err)
+	}
+	if _, err := newTestClient(sentHandler, WithPushFilters(capper)).SendPush(testPush(IDTypeAppmetricaDeviceID, "42")); !errors.Is(err, ErrEmptyPush) {
+		t.Fatalf("second send should be capped, got %v", err)
+	}
+}
+
+func TestFrequencyCapperSharedCounter(t *testing.T) {
+	capper := NewFrequencyCapper(NewMemoryFrequencyStore(),
+		&FrequencyCap{Limit: 2, Period: time.Hour},
+		&FrequencyCap{Limit: 3, Period: 24 * time.Hour},
+	)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	capper.Now = func() time.Time { return now }
+
+	sent := 0
+	for i := 0; i < 10; i++ {
+		now = now.Add(20 * time.Minute)
+		r := testPush(IDTypeAppmetricaDeviceID, "42")
+		if _, err := capper.Filter(r); err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Batch) > 0 {
+			sent++
+		}
+		if err := capper.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sent != 3 {
+		t.Fatalf("daily cap of 3 allowed %d pushes", sent)
+	}
+}
+
+func TestFileFrequencyStoreRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sends.jsonl")
+	store, err := OpenFileFrequencyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := []*FrequencyCap{{Limit: 1, Period: time.Hour}}
+	at := time.Now()
+	if ok, err := store.Reserve("k", at, time.Hour, caps); !ok || err != nil {
+		t.Fatalf("first reserve should succeed: %v %v", ok, err)
+	}
+	if ok, _ := store.Reserve("k", at, time.Hour, caps); ok {
+		t.Fatal("second reserve should be capped")
+	}
+	if err := store.Release("k", at); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = OpenFileFrequencyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if n, _ := store.Count("k", at.Add(-time.Hour)); n != 0 {
+		t.Fatalf("released record is loaded, count %d", n)
+	}
+}
+
+func TestFileFrequencyStoreCompactDuringReserve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sends.jsonl")
+	store, err := OpenFileFrequencyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := []*FrequencyCap{{Limit: 1, Period: time.Hour}}
+	at := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := store.Compact(at); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			if _, err := store.Reserve(key, at, time.Hour, caps); err != nil {
+				t.Error(err)
+			}
+		}(strconv.Itoa(i))
+	}
+	wg.Wait()
+	<-done
+	store.Close()
+
+	store, err = OpenFileFrequencyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for i := 0; i < 200; i++ {
+		if n, _ := store.Count(strconv.Itoa(i), at.Add(-time.Hour)); n != 1 {
+			t.Fatalf("key %d has %d records after compaction, want 1", i, n)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrGroupNotFound is returned by FindGroupByName when the app has no group with such name
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrGroupArchived is returned by EnsureGroup when the name is taken by an archived group.
+	// Set GroupSpec.ID to restore it.
+	ErrGroupArchived = errors.New("group name is taken by an archived group")
+)
+
+// GroupAction is the action taken on a group by EnsureGroup or Reconciler
+type GroupAction string
+
+const (
+	GroupActionNone     GroupAction = "none"     // Group already matched the requested state
+	GroupActionCreated  GroupAction = "created"  // Group was created
+	GroupActionUpdated  GroupAction = "updated"  // Group SendRate was updated
+	GroupActionArchived GroupAction = "archived" // Group was archived
+	GroupActionRestored GroupAction = "restored" // Group was restored from archive
+)
+
+// GroupSpec is the desired state of one group
+type GroupSpec struct {
+	ID       int    `json:"id,omitempty" yaml:"id,omitempty"`               // ID of the group. Optional, needed to restore archived group, since archived groups are not listed by API
+	Name     string `json:"name" yaml:"name"`                               // Name of the group, should be unique within the app
+	SendRate int    `json:"send_rate,omitempty" yaml:"send_rate,omitempty"` // SendRate of the group. Zero means API default and is never updated
+}
+
+// FindGroupByName is a function to find group of the app by its unique name.
+// Archived groups are not listed by the API, so they can't be found by name.
+// Requests of the client created by NewClient are cancelled with ctx, other clients are only checked between requests.
+func FindGroupByName(ctx context.Context, c Client, appId int, name string) (*Group, error) {
+	return findGroupByName(ctx, withContext(ctx, c), appId, name)
+}
+
+func findGroupByName(ctx context.Context, c Client, appId int, name string) (*Group, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	groups, err := c.GetGroups(appId)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Name == name {
+			return g, nil
+		}
+	}
+	return nil, ErrGroupNotFound
+}
+
+// EnsureGroup is a function to get group of the app by the name of spec, creating it if it is missing
+// and updating its SendRate if it differs. Zero SendRate leaves SendRate as is (or API default for a new group).
+// It takes GroupSpec rather than a name and a send rate, since archived groups are not listed by the API
+// and can be restored only by id: a missing group with spec.ID is restored instead of created.
+// If creating fails because the group was created concurrently, the new group is used.
+// If the name is taken by an archived group which id is unknown, ErrGroupArchived is returned.
+// Requests are cancelled with ctx the same way as by FindGroupByName.
+func EnsureGroup(ctx context.Context, c Client, appId int, spec *GroupSpec) (*Group, GroupAction, error) {
+	c = withContext(ctx, c)
+	group, err := findGroupByName(ctx, c, appId, spec.Name)
+	switch {
+	case errors.Is(err, ErrGroupNotFound) && spec.ID != 0:
+		return restoreGroup(ctx, c, spec)
+	case errors.Is(err, ErrGroupNotFound):
+		g := NewCreateGroupRequest(appId, spec.Name)
+		g.SendRate = spec.SendRate
+		created, createErr := c.CreateGroup(g)
+		if createErr == nil {
+			return created, GroupActionCreated, nil
+		}
+		// the name is taken, either by a group created since the lookup or by an archived group
+		group, err = findGroupByName(ctx, c, appId, spec.Name)
+		if errors.Is(err, ErrGroupNotFound) {
+			return nil, GroupActionNone, fmt.Errorf("%w: group %q: %v", ErrGroupArchived, spec.Name, createErr)
+		}
+	}
+	if err != nil {
+		return nil, GroupActionNone, err
+	}
+	return updateSendRate(ctx, c, group, spec, GroupActionNone)
+}
+
+// restoreGroup restores the archived group by spec.ID and brings its SendRate to spec
+func restoreGroup(ctx context.Context, c Client, spec *GroupSpec) (*Group, GroupAction, error) {
+	if err := c.RestoreGroup(spec.ID); err != nil {
+		return nil, GroupActionNone, fmt.Errorf("restore group %d: %w", spec.ID, err)
+	}
+	group, err := c.GetGroup(spec.ID)
+	if err != nil {
+		return nil, GroupActionRestored, err
+	}
+	if group.Name != spec.Name {
+		return group, GroupActionRestored, fmt.Errorf("restored group %d is named %q, not %q", spec.ID, group.Name, spec.Name)
+	}
+	return updateSendRate(ctx, c, group, spec, GroupActionRestored)
+}
+
+// updateSendRate updates SendRate of the group if spec sets a different one. Action is returned as is if nothing changed.
+func updateSendRate(ctx context.Context, c Client, group *Group, spec *GroupSpec, action GroupAction) (*Group, GroupAction, error) {
+	if spec.SendRate == 0 || group.SendRate == spec.SendRate {
+		return group, action, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, action, err
+	}
+
+	g := NewUpdateGroupRequest(spec.Name)
+	g.SendRate = spec.SendRate
+	updated, err := c.UpdateGroup(group.ID, g)
+	if err != nil {
+		return nil, action, err
+	}
+	if action == GroupActionNone {
+		action = GroupActionUpdated
+	}
+	return updated, action, nil
+}
+
+// withContext returns the client which requests are cancelled with ctx. Clients not created by NewClient are returned as is.
+func withContext(ctx context.Context, c Client) Client {
+	if cl, ok := c.(*client); ok {
+		bound := *cl
+		bound.ctx = ctx
+		return &bound
+	}
+	return c
+}
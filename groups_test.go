@@ -0,0 +1,173 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// groupAPI is Client keeping groups in memory. Archived groups are not listed and their names can't be reused.
+type groupAPI struct {
+	Client
+
+	groups   map[int]*Group
+	archived map[int]bool
+	nextId   int
+	onCreate func()
+}
+
+func newGroupAPI(groups ...*Group) *groupAPI {
+	api := &groupAPI{groups: make(map[int]*Group), archived: make(map[int]bool), nextId: 100}
+	for _, g := range groups {
+		api.groups[g.ID] = g
+	}
+	return api
+}
+
+func (a *groupAPI) GetGroups(appId int) ([]*Group, error) {
+	groups := make([]*Group, 0)
+	for id, g := range a.groups {
+		if g.AppId == appId && !a.archived[id] {
+			copied := *g
+			groups = append(groups, &copied)
+		}
+	}
+	return groups, nil
+}
+
+func (a *groupAPI) GetGroup(id int) (*Group, error) {
+	g, ok := a.groups[id]
+	if !ok {
+		return nil, errors.New("group not found")
+	}
+	copied := *g
+	return &copied, nil
+}
+
+func (a *groupAPI) CreateGroup(group *Group) (*Group, error) {
+	if a.onCreate != nil {
+		a.onCreate()
+	}
+	for _, g := range a.groups {
+		if g.AppId == group.AppId && g.Name == group.Name {
+			return nil, errors.New("group name is not unique")
+		}
+	}
+	a.nextId++
+	created := *group
+	created.ID = a.nextId
+	a.groups[created.ID] = &created
+	return &created, nil
+}
+
+func (a *groupAPI) UpdateGroup(id int, group *Group) (*Group, error) {
+	g, ok := a.groups[id]
+	if !ok {
+		return nil, errors.New("group not found")
+	}
+	if group.Name != "" {
+		g.Name = group.Name
+	}
+	if group.SendRate != 0 {
+		g.SendRate = group.SendRate
+	}
+	copied := *g
+	return &copied, nil
+}
+
+func (a *groupAPI) ArchiveGroup(id int) error {
+	if _, ok := a.groups[id]; !ok {
+		return errors.New("group not found")
+	}
+	a.archived[id] = true
+	return nil
+}
+
+func (a *groupAPI) RestoreGroup(id int) error {
+	if _, ok := a.groups[id]; !ok {
+		return errors.New("group not found")
+	}
+	delete(a.archived, id)
+	return nil
+}
+
+func TestEnsureGroup(t *testing.T) {
+	ctx := context.Background()
+	api := newGroupAPI(&Group{ID: 1, AppId: 7, Name: "news", SendRate: 1000})
+
+	tests := []struct {
+		spec   *GroupSpec
+		action GroupAction
+	}{
+		{&GroupSpec{Name: "news"}, GroupActionNone},
+		{&GroupSpec{Name: "news", SendRate: 2000}, GroupActionUpdated},
+		{&GroupSpec{Name: "promo", SendRate: 500}, GroupActionCreated},
+		{&GroupSpec{Name: "promo", SendRate: 500}, GroupActionNone},
+	}
+	for _, tt := range tests {
+		g, action, err := EnsureGroup(ctx, api, 7, tt.spec)
+		if err != nil {
+			t.Fatalf("%+v: %v", tt.spec, err)
+		}
+		if action != tt.action || g.Name != tt.spec.Name || tt.spec.SendRate != 0 && g.SendRate != tt.spec.SendRate {
+			t.Fatalf("%+v: got %s %+v, want %s", tt.spec, action, g, tt.action)
+		}
+	}
+}
+
+func TestEnsureGroupRestoresArchived(t *testing.T) {
+	ctx := context.Background()
+	api := newGroupAPI(&Group{ID: 1, AppId: 7, Name: "news", SendRate: 1000})
+	api.archived[1] = true
+
+	if _, _, err := EnsureGroup(ctx, api, 7, &GroupSpec{Name: "news"}); !errors.Is(err, ErrGroupArchived) {
+		t.Fatalf("archived name without id should give ErrGroupArchived, got %v", err)
+	}
+
+	g, action, err := EnsureGroup(ctx, api, 7, &GroupSpec{ID: 1, Name: "news", SendRate: 3000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != GroupActionRestored || g.ID != 1 || g.SendRate != 3000 || api.archived[1] {
+		t.Fatalf("got %s %+v", action, g)
+	}
+}
+
+func TestEnsureGroupCreatedConcurrently(t *testing.T) {
+	api := newGroupAPI()
+	api.onCreate = func() {
+		api.onCreate = nil
+		api.CreateGroup(&Group{AppId: 7, Name: "news"})
+	}
+
+	g, action, err := EnsureGroup(context.Background(), api, 7, &GroupSpec{Name: "news"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != GroupActionNone || g.Name != "news" {
+		t.Fatalf("got %s %+v", action, g)
+	}
+}
+
+// blockingTransport answers only when the request is cancelled
+type blockingTransport struct{}
+
+func (blockingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	<-r.Context().Done()
+	return nil, r.Context().Err()
+}
+
+func TestGroupHelpersCancelRequests(t *testing.T) {
+	c := NewClient("token", WithHTTPClient(&http.Client{Transport: blockingTransport{}}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := FindGroupByName(ctx, c, 7, "news"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("hung request should be cancelled, got %v", err)
+	}
+	if _, _, err := EnsureGroup(ctx, c, 7, &GroupSpec{Name: "news"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("hung request should be cancelled, got %v", err)
+	}
+}
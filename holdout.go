@@ -0,0 +1,151 @@
+package appmetrica_push
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+)
+
+// Holdout withholds pushes from a random control slice of the audience to measure the incremental effect of pushes.
+// A device is in the control slice depending only on its id and Salt, so the same device stays in control
+// in every request. Holdout is independent of Experiment even if they share the salt,
+// so a campaign can have both. It implements PushFilter, see WithPushFilters.
+type Holdout struct {
+	Percent  float64                                          // Percent of the audience withheld from pushes, from 0 to 100
+	Salt     string                                           // Salt of hashing, e.g. the campaign name. Change it to pick another control slice
+	Tags     []string                                         // Tags the holdout applies to. Empty means every tag
+	Groups   []int                                            // Groups the holdout applies to. Empty means every group
+	Exporter HoldoutExporter                                  // Exporter gets control devices of every request. Optional
+	OnReport func(r *PushBatchRequest, report *HoldoutReport) // OnReport is called by FilterPush for every filtered request
+}
+
+// HoldoutReport describes the split of a request by Holdout
+type HoldoutReport struct {
+	Treated        map[string]int // Treated is the number of devices left in the request per IDType
+	Control        map[string]int // Control is the number of withheld devices per IDType
+	ControlDevices []*Device      // ControlDevices are the withheld devices grouped by IDType
+	DroppedBatches int            // DroppedBatches is the number of batches left without devices and removed from the request
+}
+
+// HoldoutExporter persists control devices, so they can be compared with treated devices later.
+// Control devices are exported before the request is sent.
+type HoldoutExporter interface {
+	ExportControl(r *PushBatchRequest, control []*Device) error
+}
+
+// CSVHoldoutExporter writes control devices as CSV rows of tag, group_id, id_type and id_value.
+// The output can be read by LoadSuppressionFile. It is safe for concurrent use.
+type CSVHoldoutExporter struct {
+	mu     sync.Mutex
+	w      *csv.Writer
+	header bool
+}
+
+func NewHoldout(percent float64, salt string) *Holdout {
+	return &Holdout{Percent: percent, Salt: salt}
+}
+
+func NewCSVHoldoutExporter(w io.Writer) *CSVHoldoutExporter {
+	return &CSVHoldoutExporter{w: csv.NewWriter(w)}
+}
+
+// IsControl is a method to check if the device is in the control slice
+func (h *Holdout) IsControl(idType string, id string) bool {
+	// 53 bits are exactly representable by float64
+	point := float64(deviceHash(hashDomainHoldout, h.Salt, idType, id)>>11) / (1 << 53)
+	return point*100 < h.Percent
+}
+
+// Filter is a method to remove control devices from the request in place.
+// Batches left without devices are removed from the request.
+func (h *Holdout) Filter(r *PushBatchRequest) (*HoldoutReport, error) {
+	if h.Percent < 0 || h.Percent > 100 {
+		return nil, errors.New("holdout percent should be from 0 to 100")
+	}
+
+	report := &HoldoutReport{Treated: make(map[string]int), Control: make(map[string]int)}
+	if !inScope(r, h.Tags, h.Groups) {
+		forEachDevice(r, func(idType string, _ string) {
+			report.Treated[idType]++
+		})
+		return report, nil
+	}
+
+	control := make(map[string]*Device)
+	dropped, _ := filterDevices(r, func(idType string, id string) (bool, error) {
+		if !h.IsControl(idType, id) {
+			report.Treated[idType]++
+			return true, nil
+		}
+		report.Control[idType]++
+		c, ok := control[idType]
+		if !ok {
+			c = NewDevice(idType)
+			control[idType] = c
+			report.ControlDevices = append(report.ControlDevices, c)
+		}
+		c.IDValues = append(c.IDValues, id)
+		return false, nil
+	})
+	report.DroppedBatches = dropped
+	return report, nil
+}
+
+func (h *Holdout) FilterPush(_ context.Context, r *PushBatchRequest) error {
+	report, err := h.Filter(r)
+	if err != nil {
+		return err
+	}
+	if h.Exporter != nil && len(report.ControlDevices) > 0 {
+		if err := h.Exporter.ExportControl(r, report.ControlDevices); err != nil {
+			return err
+		}
+	}
+	if h.OnReport != nil {
+		h.OnReport(r, report)
+	}
+	return nil
+}
+
+// TreatedTotal is a method to get the number of devices left in the request
+func (r *HoldoutReport) TreatedTotal() int {
+	n := 0
+	for _, c := range r.Treated {
+		n += c
+	}
+	return n
+}
+
+// ControlTotal is a method to get the number of withheld devices
+func (r *HoldoutReport) ControlTotal() int {
+	n := 0
+	for _, c := range r.Control {
+		n += c
+	}
+	return n
+}
+
+func (e *CSVHoldoutExporter) ExportControl(r *PushBatchRequest, control []*Device) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.header {
+		if err := e.w.Write([]string{"tag", "group_id", "id_type", "id_value"}); err != nil {
+			return err
+		}
+		e.header = true
+	}
+	groupId := strconv.Itoa(r.GroupID)
+	for _, d := range control {
+		for _, id := range d.IDValues {
+			if err := e.w.Write([]string{r.Tag, groupId, d.IDType, id}); err != nil {
+				return err
+			}
+		}
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
@@ -0,0 +1,75 @@
+package appmetrica_push
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHoldoutFilter(t *testing.T) {
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i + 1)
+	}
+	var exported bytes.Buffer
+	h := NewHoldout(10, "campaign")
+	h.Exporter = NewCSVHoldoutExporter(&exported)
+
+	r := testPush(IDTypeAppmetricaDeviceID, ids...)
+	report, err := h.Filter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	control := report.ControlTotal()
+	if control < 800 || control > 1200 || report.TreatedTotal()+control != len(ids) {
+		t.Fatalf("unexpected split: treated %d, control %d", report.TreatedTotal(), control)
+	}
+	for _, id := range r.Batch[0].Devices[0].IDValues {
+		if h.IsControl(IDTypeAppmetricaDeviceID, id) {
+			t.Fatalf("control device %s is left in the request", id)
+		}
+	}
+
+	if err := h.Exporter.ExportControl(r, report.ControlDevices); err != nil {
+		t.Fatal(err)
+	}
+	if rows := strings.Count(exported.String(), "\n"); rows != control+1 {
+		t.Fatalf("exported %d rows, want %d with header", rows, control+1)
+	}
+}
+
+func TestHoldoutScope(t *testing.T) {
+	h := NewHoldout(100, "campaign")
+	h.Tags = []string{"promo"}
+
+	r := testPush(IDTypeAppmetricaDeviceID, "1", "2")
+	r.Tag = "news"
+	if report, _ := h.Filter(r); report.TreatedTotal() != 2 || len(r.Batch) != 1 {
+		t.Fatalf("holdout out of scope changed the request: %+v", report)
+	}
+
+	r.Tag = "promo"
+	if report, _ := h.Filter(r); report.ControlTotal() != 2 || report.DroppedBatches != 1 || len(r.Batch) != 0 {
+		t.Fatalf("holdout of 100%% should withhold everything: %+v", report)
+	}
+}
+
+func TestHoldoutIndependentOfExperiment(t *testing.T) {
+	h := NewHoldout(50, "campaign")
+	e := NewExperiment("campaign", NewVariant("a", 1, &Message{}), NewVariant("b", 1, &Message{}))
+
+	control, controlA := 0, 0
+	for i := 1; i <= 10000; i++ {
+		id := strconv.Itoa(i)
+		if h.IsControl(IDTypeAppmetricaDeviceID, id) {
+			control++
+			if e.Assign(IDTypeAppmetricaDeviceID, id).Name == "a" {
+				controlA++
+			}
+		}
+	}
+	if share := float64(controlA) / float64(control); share < 0.45 || share > 0.55 {
+		t.Fatalf("variant a is %.2f of the control slice with the same salt, want about 0.5", share)
+	}
+}
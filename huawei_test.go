@@ -0,0 +1,119 @@
+package appmetrica_push
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHuaweiMessageEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *Message
+		want string
+	}{
+		{"no section", &Message{Android: &AndroidMessage{}},
+			`{"android":{"silent":false,"content":null},"iOS":null}`},
+		{"section", &Message{Huawei: &HuaweiMessage{Content: &HuaweiContent{Title: "Sale", Importance: "HIGH", Category: "MARKETING"}, OpenAction: NewHuaweiOpenAction("myapp://sale")}},
+			`{"android":null,"iOS":null,"huawei":{"silent":false,"content":{"title":"Sale","text":"","icon":"","color":"","image":"","data":"","channel_id":"","importance":"HIGH","category":"MARKETING","collapse_key":0,"badge_class":"","badge_add_num":0,"time_to_live":0,"urgency":""},"open_action":{"deeplink":"myapp://sale"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("got %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestHuaweiPayloadSize(t *testing.T) {
+	android := NewAndroidMessage("Sale", "Text", false)
+	android.OpenAction = NewAndroidOpenAction("myapp://sale")
+	huawei := NewHuaweiMessage("Sale", "Text", false)
+	huawei.OpenAction = NewHuaweiOpenAction("myapp://sale")
+
+	// the same content is delivered in the same data message on both platforms
+	size := EstimatePayloadSize(&Message{Android: android, Huawei: huawei})
+	if size.Huawei == 0 || size.Huawei != size.Android {
+		t.Fatalf("got huawei %d and android %d bytes", size.Huawei, size.Android)
+	}
+	if size := EstimatePayloadSize(&Message{Android: android}); size.Huawei != 0 {
+		t.Fatalf("message without the section has huawei payload of %d bytes", size.Huawei)
+	}
+
+	huawei.Content.Text = strings.Repeat("a", HMSPayloadLimit)
+	m := &Message{Huawei: huawei}
+	if _, err := m.Validate(); err == nil {
+		t.Fatal("payload over the limit should fail validation")
+	}
+	truncated, err := m.TruncateToFit()
+	if err != nil || !truncated {
+		t.Fatalf("got %v, %v", truncated, err)
+	}
+	if size := EstimatePayloadSize(m).Huawei; size > HMSPayloadLimit {
+		t.Fatalf("payload is %d bytes after truncation", size)
+	}
+}
+
+func TestValidateHuaweiFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		content HuaweiContent
+		ok      bool
+	}{
+		{"empty", HuaweiContent{}, true},
+		{"valid", HuaweiContent{Color: "#FF0000", Importance: "NORMAL", Urgency: "high", BadgeAddNum: 1, BadgeClass: "com.example.Main", Image: "https://example.com/a.png"}, true},
+		{"color with alpha", HuaweiContent{Color: "#FFFF0000"}, false},
+		{"importance case", HuaweiContent{Importance: "high"}, false},
+		{"urgency", HuaweiContent{Urgency: "low"}, false},
+		{"badge without class", HuaweiContent{BadgeAddNum: 1}, false},
+		{"badge over 99", HuaweiContent{BadgeAddNum: 100, BadgeClass: "com.example.Main"}, false},
+		{"HTTP image", HuaweiContent{Image: "http://example.com/a.png"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.content
+			c.Title, c.Text = "Title", "Text"
+			_, err := (&Message{Huawei: &HuaweiMessage{Content: &c}}).Validate()
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v", err)
+			}
+		})
+	}
+	if _, err := (&Message{Huawei: &HuaweiMessage{Silent: true}}).Validate(); err == nil {
+		t.Fatal("section without content should fail")
+	}
+}
+
+func TestHuaweiHelpers(t *testing.T) {
+	c := &HuaweiContent{}
+	c.SetColor(Color{R: 0xff, G: 0x80, A: 0x40})
+	if c.Color != "#FF8000" {
+		t.Fatalf("got color %s", c.Color)
+	}
+
+	msg := &Message{Huawei: &HuaweiMessage{}}
+	if err := SetData(msg, map[string]int{"order": 42}); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Huawei.Content.Data != `{"order":42}` {
+		t.Fatalf("got data %s", msg.Huawei.Content.Data)
+	}
+
+	shared := &Message{Huawei: NewHuaweiMessage("Title", "Text", false)}
+	r := testPush(IDTypeHuaweiPushToken, "token")
+	r.Batch[0].Messages = shared
+	if err := NewDeeplinkBuilder([]string{"myapp"}).SetOpenActions(r, NewDeeplink("myapp", "sale")); err != nil {
+		t.Fatal(err)
+	}
+	if a := r.Batch[0].Messages.Huawei.OpenAction; a == nil || !strings.HasPrefix(a.Deeplink, "myapp://sale?") {
+		t.Fatalf("got open action %+v", a)
+	}
+	if shared.Huawei.OpenAction != nil {
+		t.Fatal("shared message is changed")
+	}
+}
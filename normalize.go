@@ -0,0 +1,201 @@
+package appmetrica_push
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NormalizeReport describes changes made by NormalizeRequest and NormalizeDevices
+type NormalizeReport struct {
+	Total          int           // Total number of device ids before normalization
+	Changed        int           // Changed is the number of ids rewritten into canonical form
+	Merged         int           // Merged is the number of duplicate ids dropped
+	Rejected       []*RejectedID // Rejected ids which are invalid for their IDType
+	DroppedBatches int           // DroppedBatches is the number of batches left without devices and removed from the request
+}
+
+// RejectedID is a device id dropped during normalization
+type RejectedID struct {
+	IDType string // IDType of the device
+	Value  string // Value as it was before normalization
+	Err    error  // Err describes why the value was rejected
+}
+
+// NormalizeDeviceID is a function to trim id and bring it to the canonical form of idType:
+// push tokens of APNs are lowercase hex, ios_ifa is uppercase UUID, google_aid and huawei_oaid are lowercase UUID,
+// appmetrica_device_id is a number. FCM and HMS tokens are case-sensitive and are only trimmed.
+func NormalizeDeviceID(idType string, id string) (string, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return "", errors.New("device id is empty")
+	}
+
+	switch idType {
+	case IDTypeIOSPushToken:
+		// tokens are often logged as NSData description, e.g. <0a1b 2c3d ...>
+		token := strings.ToLower(strings.Map(func(r rune) rune {
+			if r == '<' || r == '>' || r == ' ' {
+				return -1
+			}
+			return r
+		}, id))
+		if len(token)%2 != 0 || !isHex(token) {
+			return "", fmt.Errorf("%s should be hex encoded", idType)
+		}
+		return token, nil
+	case IDTypeIOSIFA:
+		uuid, ok := canonicalUUID(id)
+		if !ok {
+			return "", fmt.Errorf("%s should be UUID", idType)
+		}
+		return strings.ToUpper(uuid), nil
+	case IDTypeGoogleAID:
+		uuid, ok := canonicalUUID(id)
+		if !ok {
+			return "", fmt.Errorf("%s should be UUID", idType)
+		}
+		return uuid, nil
+	case IDTypeHuaweiOAID:
+		// OAID is usually UUID, but some vendors use other formats
+		if uuid, ok := canonicalUUID(id); ok {
+			return uuid, nil
+		}
+	case IDTypeAppmetricaDeviceID:
+		if !isDigits(id) {
+			return "", fmt.Errorf("%s should be numeric", idType)
+		}
+		return id, nil
+	}
+
+	if strings.ContainsAny(id, " \t\r\n") {
+		return "", fmt.Errorf("%s should not contain whitespace", idType)
+	}
+	return id, nil
+}
+
+// NormalizeDevices is a function to normalize ids of devices and drop duplicates. Devices are not changed,
+// the returned slice has new devices with normalized ids, devices left without ids are removed.
+// Duplicates are removed only within one IDType: the same phone listed by appmetrica_device_id
+// and by ios_push_token can't be matched by ids alone and stays in both.
+func NormalizeDevices(devices []*Device) ([]*Device, *NormalizeReport) {
+	report := &NormalizeReport{}
+	return normalizeDevices(devices, make(map[string]map[string]bool), report), report
+}
+
+// NormalizeRequest is a method to normalize ids of all devices of the request and drop duplicates across its batches.
+// As in NormalizeDevices, duplicates are removed only within one IDType.
+// Batches of the request are replaced with new ones, the first occurrence of every id is kept,
+// batches left without devices are removed. Batches and devices shared with other requests are not changed.
+func NormalizeRequest(r *PushBatchRequest) *NormalizeReport {
+	report := &NormalizeReport{}
+	seen := make(map[string]map[string]bool)
+	batches := make([]*Batch, len(r.Batch))
+	for i, b := range r.Batch {
+		if b != nil {
+			batches[i] = &Batch{Messages: b.Messages, Devices: normalizeDevices(b.Devices, seen, report)}
+		}
+	}
+	r.Batch = batches
+	report.DroppedBatches = dropEmptyBatches(r)
+	return report
+}
+
+func normalizeDevices(devices []*Device, seen map[string]map[string]bool, report *NormalizeReport) []*Device {
+	out := make([]*Device, 0, len(devices))
+	for _, d := range devices {
+		if d == nil {
+			continue
+		}
+		if seen[d.IDType] == nil {
+			seen[d.IDType] = make(map[string]bool)
+		}
+
+		ids := make([]string, 0, len(d.IDValues))
+		for _, raw := range d.IDValues {
+			report.Total++
+			id, err := NormalizeDeviceID(d.IDType, raw)
+			if err != nil {
+				report.Rejected = append(report.Rejected, &RejectedID{IDType: d.IDType, Value: raw, Err: err})
+				continue
+			}
+			if id != raw {
+				report.Changed++
+			}
+			if seen[d.IDType][id] {
+				report.Merged++
+				continue
+			}
+			seen[d.IDType][id] = true
+			ids = append(ids, id)
+		}
+
+		if len(ids) > 0 {
+			out = append(out, &Device{IDType: d.IDType, IDValues: ids})
+		}
+	}
+	return out
+}
+
+// deviceKey is the normalized id, so the same device matches regardless of case and whitespace
+func deviceKey(idType string, id string) string {
+	if normalized, err := NormalizeDeviceID(idType, id); err == nil {
+		return normalized
+	}
+	return strings.TrimSpace(id)
+}
+
+// dropEmptyBatches removes batches without devices from the request and returns the number of removed batches
+func dropEmptyBatches(r *PushBatchRequest) int {
+	batches := make([]*Batch, 0, len(r.Batch))
+	for _, b := range r.Batch {
+		if b != nil && countDevices(b.Devices) > 0 {
+			batches = append(batches, b)
+		}
+	}
+	dropped := len(r.Batch) - len(batches)
+	r.Batch = batches
+	return dropped
+}
+
+func countDevices(devices []*Device) int {
+	n := 0
+	for _, d := range devices {
+		if d != nil {
+			n += len(d.IDValues)
+		}
+	}
+	return n
+}
+
+// canonicalUUID returns lowercase 8-4-4-4-12 form of UUID written with or without dashes and braces
+func canonicalUUID(s string) (string, bool) {
+	s = strings.ToLower(strings.Trim(s, "{}"))
+	hex := strings.ReplaceAll(s, "-", "")
+	if len(hex) != 32 || !isHex(hex) {
+		return "", false
+	}
+	if strings.Contains(s, "-") && (len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-') {
+		return "", false
+	}
+	return hex[0:8] + "-" + hex[8:12] + "-" + hex[12:16] + "-" + hex[16:20] + "-" + hex[20:32], true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,43 @@
+package appmetrica_push
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeRequestSharedDevice(t *testing.T) {
+	device := NewDevice(IDTypeIOSPushToken, "AB", "cd")
+	r := &PushBatchRequest{Batch: []*Batch{
+		{Messages: &Message{}, Devices: []*Device{device}},
+		{Messages: &Message{}, Devices: []*Device{device}},
+	}}
+
+	report := NormalizeRequest(r)
+	if report.DroppedBatches != 1 || report.Merged != 2 || report.Changed != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if len(r.Batch) != 1 || !reflect.DeepEqual(r.Batch[0].Devices[0].IDValues, []string{"ab", "cd"}) {
+		t.Fatalf("first occurrence should survive, got %+v", r.Batch)
+	}
+	if !reflect.DeepEqual(device.IDValues, []string{"AB", "cd"}) {
+		t.Fatalf("shared device should not be changed, got %v", device.IDValues)
+	}
+}
+
+func TestNormalizeDevicesKeepsInput(t *testing.T) {
+	devices := []*Device{
+		NewDevice(IDTypeGoogleAID, "not a uuid"),
+		NewDevice(IDTypeGoogleAID, "{01234567-89AB-CDEF-0123-456789ABCDEF}", "0123456789abcdef0123456789abcdef"),
+	}
+
+	normalized, report := NormalizeDevices(devices)
+	if len(normalized) != 1 || !reflect.DeepEqual(normalized[0].IDValues, []string{"01234567-89ab-cdef-0123-456789abcdef"}) {
+		t.Fatalf("unexpected devices %+v", normalized)
+	}
+	if len(report.Rejected) != 1 || report.Merged != 1 || report.Total != 3 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if devices[0].IDValues[0] != "not a uuid" || len(devices[1].IDValues) != 2 {
+		t.Fatalf("input devices should not be changed, got %v %v", devices[0].IDValues, devices[1].IDValues)
+	}
+}
@@ -0,0 +1,391 @@
+package appmetrica_push
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Limits of payloads of push services
+const (
+	APNsPayloadLimit = 4096 // APNsPayloadLimit is the max size of iOS push payload in bytes
+	FCMPayloadLimit  = 4096 // FCMPayloadLimit is the max size of Android push payload in bytes
+	HMSPayloadLimit  = 4096 // HMSPayloadLimit is the max size of Huawei push payload in bytes
+)
+
+const (
+	// payloadOverhead approximates fields AppMetrica adds to every payload, e.g. push id and tracking info
+	payloadOverhead = 256
+	// payloadWarnRatio is the part of the limit after which Validate warns about payload size
+	payloadWarnRatio = 0.9
+	// ellipsis is appended to truncated text
+	ellipsis = "…"
+)
+
+// PayloadSize is the estimated size of payloads delivered to devices. The estimate is close to the size
+// AppMetrica sends to push services, but it is not exact, so keep some margin below the limits.
+type PayloadSize struct {
+	Android int // Android is the size of FCM payload in bytes, 0 if there is no Android section
+	IOS     int // IOS is the size of APNs payload in bytes, 0 if there is no iOS section
+	Huawei  int // Huawei is the size of HMS payload in bytes, 0 if there is no Huawei section
+}
+
+// PayloadSizeError is returned by Validate when the estimated payload exceeds the limit of the platform
+type PayloadSizeError struct {
+	Platform string // Platform of the payload, android, iOS or huawei
+	Size     int    // Size is the estimated payload size in bytes
+	Limit    int    // Limit of the platform in bytes
+}
+
+func (e *PayloadSizeError) Error() string {
+	return fmt.Sprintf("%s payload is about %d bytes, limit is %d", e.Platform, e.Size, e.Limit)
+}
+
+// EstimatePayloadSize is a function to approximate sizes of payloads of the message on every platform
+func EstimatePayloadSize(m *Message) PayloadSize {
+	var size PayloadSize
+	if m == nil {
+		return size
+	}
+	if m.Android != nil {
+		size.Android = androidPayloadSize(m.Android)
+	}
+	if m.IOS != nil {
+		size.IOS = iosPayloadSize(m.IOS)
+	}
+	if m.Huawei != nil {
+		size.Huawei = huaweiPayloadSize(m.Huawei)
+	}
+	return size
+}
+
+// Validate is a method to check the message before sending: at least one platform section is set,
+// non-silent messages have title and text, and payloads fit into limits of push services.
+// Payloads larger than the limit are reported as *PayloadSizeError, payloads close to the limit produce warnings.
+func (m *Message) Validate() ([]string, error) {
+	if m.Android == nil && m.IOS == nil && m.Huawei == nil {
+		return nil, errors.New("message has no platform sections")
+	}
+	if a := m.Android; a != nil {
+		if a.Content == nil {
+			return nil, errors.New("android message has no content")
+		}
+		if !a.Silent && (a.Content.Title == "" || a.Content.Text == "") {
+			return nil, errors.New("android message should have title and text unless it is silent")
+		}
+		if a.Content.Priority < -2 || a.Content.Priority > 2 {
+			return nil, errors.New("android priority should be from -2 to 2")
+		}
+		if err := validateAndroidFields(a.Content); err != nil {
+			return nil, err
+		}
+	}
+	if i := m.IOS; i != nil {
+		if i.Content == nil {
+			return nil, errors.New("iOS message has no content")
+		}
+		if !i.Silent && (i.Content.Title == "" || i.Content.Text == "") {
+			return nil, errors.New("iOS message should have title and text unless it is silent")
+		}
+	}
+	if h := m.Huawei; h != nil {
+		if h.Content == nil {
+			return nil, errors.New("huawei message has no content")
+		}
+		if !h.Silent && (h.Content.Title == "" || h.Content.Text == "") {
+			return nil, errors.New("huawei message should have title and text unless it is silent")
+		}
+		if err := validateHuaweiFields(h.Content); err != nil {
+			return nil, err
+		}
+	}
+
+	size := EstimatePayloadSize(m)
+	warnings := make([]string, 0)
+	for _, p := range []*PayloadSizeError{
+		{Platform: "android", Size: size.Android, Limit: FCMPayloadLimit},
+		{Platform: "iOS", Size: size.IOS, Limit: APNsPayloadLimit},
+		{Platform: "huawei", Size: size.Huawei, Limit: HMSPayloadLimit},
+	} {
+		if p.Size > p.Limit {
+			return warnings, p
+		}
+		if float64(p.Size) > float64(p.Limit)*payloadWarnRatio {
+			warnings = append(warnings, p.Error())
+		}
+	}
+	return warnings, nil
+}
+
+// Validate is a method to check the request and messages of all its batches before sending
+func (r *PushBatchRequest) Validate() ([]string, error) {
+	if r.GroupID == 0 {
+		return nil, errors.New("group id is required")
+	}
+	if r.Tag == "" {
+		return nil, errors.New("tag is required")
+	}
+	if len(r.Batch) == 0 {
+		return nil, errors.New("request has no batches")
+	}
+
+	warnings := make([]string, 0)
+	devices := 0
+	for i, b := range r.Batch {
+		if b == nil || b.Messages == nil {
+			return warnings, fmt.Errorf("batch %d has no message", i)
+		}
+		if len(b.Devices) == 0 {
+			return warnings, fmt.Errorf("batch %d has no devices", i)
+		}
+		if len(b.Devices) > MaxDeviceGroupsPerRequest {
+			return warnings, fmt.Errorf("batch %d has %d device groups, max is %d", i, len(b.Devices), MaxDeviceGroupsPerRequest)
+		}
+		devices += countDevices(b.Devices)
+
+		w, err := b.Messages.Validate()
+		for _, warning := range w {
+			warnings = append(warnings, fmt.Sprintf("batch %d: %s", i, warning))
+		}
+		if err != nil {
+			return warnings, fmt.Errorf("batch %d: %w", i, err)
+		}
+	}
+	if devices > MaxDevicesPerRequest {
+		return warnings, fmt.Errorf("request has %d devices, max is %d", devices, MaxDevicesPerRequest)
+	}
+	return warnings, nil
+}
+
+// TruncateToFit is a method to shorten Text of platform sections whose payload exceeds the limit.
+// Text is cut on grapheme boundaries, so emoji and combined characters are never broken, and ends with an ellipsis.
+// It returns true if any text was truncated and an error if the payload doesn't fit even with empty text.
+func (m *Message) TruncateToFit() (bool, error) {
+	truncated := false
+	if a := m.Android; a != nil && a.Content != nil {
+		ok, err := truncateText("android", &a.Content.Text, FCMPayloadLimit, func() int { return androidPayloadSize(a) })
+		if err != nil {
+			return truncated, err
+		}
+		truncated = truncated || ok
+	}
+	if i := m.IOS; i != nil && i.Content != nil {
+		ok, err := truncateText("iOS", &i.Content.Text, APNsPayloadLimit, func() int { return iosPayloadSize(i) })
+		if err != nil {
+			return truncated, err
+		}
+		truncated = truncated || ok
+	}
+	if h := m.Huawei; h != nil && h.Content != nil {
+		ok, err := truncateText("huawei", &h.Content.Text, HMSPayloadLimit, func() int { return huaweiPayloadSize(h) })
+		if err != nil {
+			return truncated, err
+		}
+		truncated = truncated || ok
+	}
+	return truncated, nil
+}
+
+// truncateText finds the longest grapheme prefix of text which keeps size within limit
+func truncateText(platform string, text *string, limit int, size func() int) (bool, error) {
+	original := *text
+	if s := size(); s <= limit {
+		return false, nil
+	}
+
+	graphemes := splitGraphemes(original)
+	lo, hi := 0, len(graphemes)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		*text = strings.Join(graphemes[:mid], "") + ellipsis
+		if size() <= limit {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	*text = strings.Join(graphemes[:lo], "") + ellipsis
+	if lo == 0 {
+		*text = ""
+	}
+	if s := size(); s > limit {
+		*text = original
+		return false, &PayloadSizeError{Platform: platform, Size: s, Limit: limit}
+	}
+	return true, nil
+}
+
+// androidPayloadSize estimates FCM data message. AppMetrica passes the content as JSON string in a data field,
+// so quotes and backslashes are escaped twice.
+func androidPayloadSize(a *AndroidMessage) int {
+	var action interface{}
+	if a.OpenAction != nil && a.OpenAction.Deeplink != "" {
+		action = a.OpenAction
+	}
+	return dataMessageSize(a.Content, action, a.Silent)
+}
+
+// huaweiPayloadSize estimates HMS data message, which is built by AppMetrica like the Android one
+func huaweiPayloadSize(h *HuaweiMessage) int {
+	var action interface{}
+	if h.OpenAction != nil && h.OpenAction.Deeplink != "" {
+		action = h.OpenAction
+	}
+	return dataMessageSize(h.Content, action, h.Silent)
+}
+
+func dataMessageSize(content interface{}, action interface{}, silent bool) int {
+	inner := nonZeroFields(content)
+	if action != nil {
+		inner["open_action"] = action
+	}
+	if silent {
+		inner["silent"] = true
+	}
+	data, _ := marshalPayload(inner)
+	payload, _ := marshalPayload(map[string]string{"yamp": string(data)})
+	return len(payload) + payloadOverhead
+}
+
+// iosPayloadSize estimates APNs payload: the visible part goes to aps dictionary, the rest to AppMetrica dictionary
+func iosPayloadSize(i *IOSMessage) int {
+	c := i.Content
+	aps := make(map[string]interface{})
+	if c != nil {
+		alert := make(map[string]string)
+		if c.Title != "" {
+			alert["title"] = c.Title
+		}
+		if c.Text != "" {
+			alert["body"] = c.Text
+		}
+		if len(alert) > 0 {
+			aps["alert"] = alert
+		}
+		if c.Badge != 0 {
+			aps["badge"] = c.Badge
+		}
+		if c.Sound != "" {
+			aps["sound"] = c.Sound
+		}
+		if c.ThreadID != "" {
+			aps["thread-id"] = c.ThreadID
+		}
+		if c.Category != "" {
+			aps["category"] = c.Category
+		}
+		if c.MutableContent != 0 {
+			aps["mutable-content"] = c.MutableContent
+		}
+	}
+	if i.Silent {
+		aps["content-available"] = 1
+	}
+
+	yamp := make(map[string]interface{})
+	if c != nil {
+		if c.Data != "" {
+			yamp["d"] = c.Data
+		}
+		if len(c.Attachments) > 0 {
+			yamp["a"] = c.Attachments
+		}
+	}
+	if i.OpenAction != nil && i.OpenAction.URL != "" {
+		yamp["u"] = i.OpenAction.URL
+	}
+
+	payload, _ := marshalPayload(map[string]interface{}{"aps": aps, "yamp": yamp})
+	return len(payload) + payloadOverhead
+}
+
+// nonZeroFields returns JSON fields of v without zero values, which are not sent to devices
+func nonZeroFields(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := marshalPayload(v)
+	if err != nil {
+		return fields
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fields
+	}
+	for k, v := range raw {
+		switch string(v) {
+		case `""`, `0`, `false`, `null`, `[]`, `{}`:
+			continue
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+// marshalPayload encodes v like push services do, without escaping of HTML characters
+func marshalPayload(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// splitGraphemes splits s into user-perceived characters. It approximates Unicode extended grapheme clusters:
+// combining marks, variation selectors, emoji modifiers and ZWJ sequences stay with their base character,
+// regional indicators are paired into flags.
+func splitGraphemes(s string) []string {
+	graphemes := make([]string, 0, len(s))
+	start := 0
+	var prev rune = -1
+	regional := 0
+	for i, r := range s {
+		if prev != -1 && !continuesGrapheme(prev, r, regional) {
+			graphemes = append(graphemes, s[start:i])
+			start = i
+			regional = 0
+		}
+		if isRegionalIndicator(r) {
+			regional++
+		}
+		prev = r
+	}
+	if start < len(s) {
+		graphemes = append(graphemes, s[start:])
+	}
+	return graphemes
+}
+
+// continuesGrapheme tells if r belongs to the grapheme of prev. regional is the number of regional indicators in the grapheme.
+func continuesGrapheme(prev rune, r rune, regional int) bool {
+	switch {
+	case prev == '\r' && r == '\n':
+		return true
+	case prev == '\u200d': // zero width joiner glues emoji sequences
+		return true
+	case isRegionalIndicator(r):
+		return regional%2 == 1 && isRegionalIndicator(prev)
+	}
+	return isGraphemeExtend(r)
+}
+
+func isGraphemeExtend(r rune) bool {
+	switch {
+	case r == '\u200d',
+		r >= 0xFE00 && r <= 0xFE0F, // variation selectors
+		r >= 0xE0100 && r <= 0xE01EF,
+		r >= 0x1F3FB && r <= 0x1F3FF, // emoji skin tone modifiers
+		r >= 0xE0020 && r <= 0xE007F, // tags of flag sequences
+		r >= 0x1160 && r <= 0x11FF:   // hangul medial vowels and final consonants
+		return true
+	}
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
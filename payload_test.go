@@ -0,0 +1,154 @@
+package appmetrica_push
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitGraphemes(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"ascii", "abc", []string{"a", "b", "c"}},
+		{"combining mark", "éx", []string{"é", "x"}},
+		{"skin tone", "👍🏽!", []string{"👍🏽", "!"}},
+		{"zwj sequence", "👨‍👩‍👧a", []string{"👨‍👩‍👧", "a"}},
+		{"variation selector", "❤️a", []string{"❤️", "a"}},
+		{"flags", "🇩🇪🇫🇷🇯", []string{"🇩🇪", "🇫🇷", "🇯"}},
+		{"crlf", "a\r\nb", []string{"a", "\r\n", "b"}},
+		{"empty", "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitGraphemes(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateToFit(t *testing.T) {
+	tests := []struct {
+		name string
+		unit string
+	}{
+		{"ascii", "a"},
+		{"combining mark", "é"},
+		{"skin tone", "👍🏽"},
+		{"zwj sequence", "👨‍👩‍👧"},
+		{"flag", "🇩🇪"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := strings.Repeat(tt.unit, FCMPayloadLimit)
+			m := &Message{Android: NewAndroidMessage("Title", text, false)}
+
+			truncated, err := m.TruncateToFit()
+			if err != nil || !truncated {
+				t.Fatalf("got %v, %v", truncated, err)
+			}
+			got := m.Android.Content.Text
+			if !strings.HasSuffix(got, ellipsis) {
+				t.Fatalf("truncated text should end with ellipsis, got %q", got[len(got)-8:])
+			}
+			if rest := strings.TrimSuffix(got, ellipsis); strings.Trim(rest, tt.unit) != "" {
+				t.Fatal("text is cut inside a grapheme")
+			}
+			if size := EstimatePayloadSize(m).Android; size > FCMPayloadLimit {
+				t.Fatalf("payload is %d bytes after truncation", size)
+			}
+
+			// one more grapheme doesn't fit
+			m.Android.Content.Text = strings.TrimSuffix(got, ellipsis) + tt.unit + ellipsis
+			if size := EstimatePayloadSize(m).Android; size <= FCMPayloadLimit {
+				t.Fatalf("text is cut shorter than needed, %d bytes", size)
+			}
+		})
+	}
+}
+
+func TestTruncateToFitUnchanged(t *testing.T) {
+	m := &Message{
+		Android: NewAndroidMessage("Title", "Text", false),
+		IOS:     NewIOSMessage("Title", "Text", false),
+	}
+	truncated, err := m.TruncateToFit()
+	if err != nil || truncated {
+		t.Fatalf("got %v, %v", truncated, err)
+	}
+	if m.Android.Content.Text != "Text" || m.IOS.Content.Text != "Text" {
+		t.Fatal("text which fits is changed")
+	}
+}
+
+func TestTruncateToFitTooLarge(t *testing.T) {
+	m := &Message{IOS: NewIOSMessage(strings.Repeat("t", APNsPayloadLimit), "Text", false)}
+	truncated, err := m.TruncateToFit()
+
+	var sizeErr *PayloadSizeError
+	if !errors.As(err, &sizeErr) || sizeErr.Platform != "iOS" || truncated {
+		t.Fatalf("got %v, %v", truncated, err)
+	}
+	if m.IOS.Content.Text != "Text" {
+		t.Fatalf("text should be restored, got %q", m.IOS.Content.Text)
+	}
+}
+
+func TestMessageValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		msg      *Message
+		warnings int
+		err      bool
+	}{
+		{"valid", &Message{Android: NewAndroidMessage("Title", "Text", false)}, 0, false},
+		{"no sections", &Message{}, 0, true},
+		{"no title", &Message{IOS: NewIOSMessage("", "Text", false)}, 0, true},
+		{"silent without title", &Message{Android: NewAndroidMessage("", "", true)}, 0, false},
+		{"bad priority", &Message{Android: &AndroidMessage{Content: &AndroidContent{Title: "T", Text: "T", Priority: 3}}}, 0, true},
+		{"close to limit", &Message{Android: NewAndroidMessage("Title", strings.Repeat("a", FCMPayloadLimit-600), false)}, 1, false},
+		{"over limit", &Message{Android: NewAndroidMessage("Title", strings.Repeat("a", FCMPayloadLimit), false)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings, err := tt.msg.Validate()
+			if (err != nil) != tt.err || len(warnings) != tt.warnings {
+				t.Fatalf("got %q, %v", warnings, err)
+			}
+		})
+	}
+}
+
+func TestPushBatchRequestValidate(t *testing.T) {
+	valid := func() *PushBatchRequest {
+		r := testPush(IDTypeAppmetricaDeviceID, "1")
+		r.Batch[0].Messages = &Message{Android: NewAndroidMessage("Title", "Text", false)}
+		return r
+	}
+	tests := []struct {
+		name   string
+		change func(r *PushBatchRequest)
+		err    string
+	}{
+		{"valid", func(r *PushBatchRequest) {}, ""},
+		{"no group", func(r *PushBatchRequest) { r.GroupID = 0 }, "group id is required"},
+		{"no tag", func(r *PushBatchRequest) { r.Tag = "" }, "tag is required"},
+		{"no batches", func(r *PushBatchRequest) { r.Batch = nil }, "request has no batches"},
+		{"no devices", func(r *PushBatchRequest) { r.Batch[0].Devices = nil }, "batch 0 has no devices"},
+		{"invalid message", func(r *PushBatchRequest) { r.Batch[0].Messages = &Message{} }, "batch 0: message has no platform sections"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := valid()
+			tt.change(r)
+			_, err := r.Validate()
+			if err == nil && tt.err != "" || err != nil && err.Error() != tt.err {
+				t.Fatalf("got %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,365 @@
+package appmetrica_push
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxAndroidImageSize is the max size of image and banner files of Android notifications
+const MaxAndroidImageSize = 1 << 20
+
+// DefaultPreflightCacheTTL is the default time outcomes of URL checks are reused by Preflight
+const DefaultPreflightCacheTTL = 10 * time.Minute
+
+// androidImageTypes are content types of images Android notifications can show
+var androidImageTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/webp": true, "image/gif": true}
+
+// Preflight checks every unique image, banner and attachment URL of a request concurrently before it is sent:
+// the file is reachable, has expected content type and size, and PNG and JPEG images have expected dimensions.
+// It implements PushFilter, so with Refuse set SendPush fails when any check fails, see WithPushFilters.
+type Preflight struct {
+	Checker      URLChecker                                         // Checker requests files. Dimensions are checked only if it implements URLOpener. Default is HTTPURLChecker with http.DefaultClient
+	Workers      int                                                // Workers is the number of URLs checked concurrently. Default is 8
+	MaxImageSize int64                                              // MaxImageSize of Android image and banner in bytes. Default is MaxAndroidImageSize
+	MinWidth     int                                                // MinWidth of PNG and JPEG images in pixels. Zero means no limit
+	MinHeight    int                                                // MinHeight of PNG and JPEG images in pixels. Zero means no limit
+	MaxWidth     int                                                // MaxWidth of PNG and JPEG images in pixels. Zero means no limit
+	MaxHeight    int                                                // MaxHeight of PNG and JPEG images in pixels. Zero means no limit
+	Refuse       bool                                               // Refuse to send the request by FilterPush if any check fails
+	CacheTTL     time.Duration                                      // CacheTTL is how long a fetched URL is reused by checks of later requests. Default is DefaultPreflightCacheTTL, negative disables the cache
+	OnReport     func(r *PushBatchRequest, report *PreflightReport) // OnReport is called by FilterPush for every checked request
+
+	mu    sync.Mutex
+	cache map[string]*fetchedURL
+}
+
+// fetchedURL is what was learned by fetching a URL. Concurrent checks of the URL wait for done and share it.
+type fetchedURL struct {
+	done     chan struct{}
+	expires  time.Time
+	info     *URLInfo
+	width    int
+	height   int
+	err      error // err is set if the file is unreachable
+	imageErr error // imageErr is set if the image header is broken
+}
+
+// PreflightReport is the outcome of checks of all URLs of a request, ordered by URL
+type PreflightReport struct {
+	Checks []*URLCheck
+}
+
+// URLCheck is the outcome of checks of a single URL
+type URLCheck struct {
+	URL         string   // URL of the file
+	Fields      []string // Fields using the URL, e.g. android.image, android.banner, huawei.image, ios.attachments
+	ContentType string   // ContentType of the file, empty if unknown
+	Size        int64    // Size of the file in bytes, -1 if unknown
+	Width       int      // Width of PNG or JPEG image, 0 if unknown
+	Height      int      // Height of PNG or JPEG image, 0 if unknown
+	Err         error    // Err describes the failed check, nil if all checks passed
+}
+
+// PreflightError is returned by FilterPush when Refuse is set and some checks failed
+type PreflightError struct {
+	Failed []*URLCheck
+}
+
+func NewPreflight(checker URLChecker) *Preflight {
+	if checker == nil {
+		checker = NewHTTPURLChecker(nil)
+	}
+	return &Preflight{Checker: checker, Workers: 8, MaxImageSize: MaxAndroidImageSize}
+}
+
+func (e *PreflightError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, c := range e.Failed {
+		msgs[i] = fmt.Sprintf("%s (%s): %v", c.URL, strings.Join(c.Fields, ", "), c.Err)
+	}
+	return "preflight failed: " + strings.Join(msgs, "; ")
+}
+
+// Check is a method to check all URLs of the request
+func (p *Preflight) Check(ctx context.Context, r *PushBatchRequest) *PreflightReport {
+	checks := collectURLs(r)
+
+	workers := p.Workers
+	if workers < 1 {
+		workers = 8
+	}
+	jobs := make(chan *URLCheck)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				p.check(ctx, c)
+			}
+		}()
+	}
+	for _, c := range checks {
+		jobs <- c
+	}
+	close(jobs)
+	wg.Wait()
+
+	return &PreflightReport{Checks: checks}
+}
+
+func (p *Preflight) FilterPush(ctx context.Context, r *PushBatchRequest) error {
+	report := p.Check(ctx, r)
+	if p.OnReport != nil {
+		p.OnReport(r, report)
+	}
+	if p.Refuse {
+		return report.Err()
+	}
+	return nil
+}
+
+// Failed is a method to get checks which failed
+func (r *PreflightReport) Failed() []*URLCheck {
+	failed := make([]*URLCheck, 0)
+	for _, c := range r.Checks {
+		if c.Err != nil {
+			failed = append(failed, c)
+		}
+	}
+	return failed
+}
+
+// Err is a method to get *PreflightError if any check failed, nil otherwise
+func (r *PreflightReport) Err() error {
+	if failed := r.Failed(); len(failed) > 0 {
+		return &PreflightError{Failed: failed}
+	}
+	return nil
+}
+
+func (p *Preflight) check(ctx context.Context, c *URLCheck) {
+	c.Size = -1
+	f := p.fetched(ctx, c.URL)
+	if f.err != nil {
+		c.Err = f.err
+		return
+	}
+	c.ContentType = f.info.ContentType
+	c.Size = f.info.ContentLength
+
+	for _, field := range c.Fields {
+		if c.Err = p.checkField(c.URL, field, f.info); c.Err != nil {
+			return
+		}
+	}
+	if f.imageErr != nil {
+		c.Err = f.imageErr
+		return
+	}
+	if f.width > 0 || f.height > 0 {
+		c.Width, c.Height = f.width, f.height
+		c.Err = p.checkDimensions(c.Width, c.Height)
+	}
+}
+
+// fetched returns the URL fetched by this or a recent check, so a campaign split into many requests
+// downloads every file once
+func (p *Preflight) fetched(ctx context.Context, url string) *fetchedURL {
+	ttl := p.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultPreflightCacheTTL
+	}
+	if ttl < 0 {
+		f := &fetchedURL{done: make(chan struct{})}
+		p.fetch(ctx, url, f)
+		return f
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	f, ok := p.cache[url]
+	if !ok || isClosed(f.done) && !f.expires.After(now) {
+		if p.cache == nil {
+			p.cache = make(map[string]*fetchedURL)
+		}
+		for u, cached := range p.cache {
+			if isClosed(cached.done) && !cached.expires.After(now) {
+				delete(p.cache, u)
+			}
+		}
+		f = &fetchedURL{done: make(chan struct{})}
+		p.cache[url] = f
+		p.mu.Unlock()
+
+		p.fetch(ctx, url, f)
+		p.mu.Lock()
+		f.expires = time.Now().Add(ttl)
+		if ctx.Err() != nil {
+			// the outcome of a cancelled check says nothing about the URL
+			delete(p.cache, url)
+		}
+		p.mu.Unlock()
+		close(f.done)
+		return f
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f
+	case <-ctx.Done():
+		return &fetchedURL{err: fmt.Errorf("unreachable: %w", ctx.Err())}
+	}
+}
+
+// fetch requests the file and reads the image header if the checker can download it
+func (p *Preflight) fetch(ctx context.Context, url string, f *fetchedURL) {
+	var (
+		info *URLInfo
+		body io.ReadCloser
+		err  error
+	)
+	if opener, ok := p.Checker.(URLOpener); ok {
+		info, body, err = opener.Open(ctx, url)
+	} else {
+		info, err = p.Checker.Head(ctx, url)
+	}
+	if err != nil {
+		f.err = fmt.Errorf("unreachable: %w", err)
+		return
+	}
+	if body != nil {
+		defer body.Close()
+	}
+	if f.err = checkReachable(info); f.err != nil {
+		return
+	}
+	f.info = info
+
+	if body == nil || (info.ContentType != "image/png" && info.ContentType != "image/jpeg") {
+		return
+	}
+	if f.width, f.height, err = imageSize(info.ContentType, body); err != nil {
+		f.imageErr = fmt.Errorf("broken image: %w", err)
+	}
+}
+
+func isClosed(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Preflight) checkField(fileURL string, field string, info *URLInfo) error {
+	if field == "ios.attachments" {
+		u, err := url.Parse(fileURL)
+		if err != nil {
+			return err
+		}
+		fileType, ok := inferFileType(u, info.ContentType)
+		if !ok {
+			return fmt.Errorf("content type %q can't be attached", info.ContentType)
+		}
+		if limit := AttachmentSizeLimit(fileType); info.ContentLength > int64(limit) {
+			return fmt.Errorf("%s file is %d bytes, iOS limit is %d", fileType, info.ContentLength, limit)
+		}
+		return nil
+	}
+
+	if !androidImageTypes[info.ContentType] {
+		return fmt.Errorf("content type %q is not an image", info.ContentType)
+	}
+	limit := p.MaxImageSize
+	if limit <= 0 {
+		limit = MaxAndroidImageSize
+	}
+	if info.ContentLength > limit {
+		return fmt.Errorf("image is %d bytes, limit is %d", info.ContentLength, limit)
+	}
+	return nil
+}
+
+func (p *Preflight) checkDimensions(width int, height int) error {
+	if (p.MinWidth > 0 && width < p.MinWidth) || (p.MinHeight > 0 && height < p.MinHeight) {
+		return fmt.Errorf("image is %dx%d, min is %dx%d", width, height, p.MinWidth, p.MinHeight)
+	}
+	if (p.MaxWidth > 0 && width > p.MaxWidth) || (p.MaxHeight > 0 && height > p.MaxHeight) {
+		return fmt.Errorf("image is %dx%d, max is %dx%d", width, height, p.MaxWidth, p.MaxHeight)
+	}
+	return nil
+}
+
+// imageSize decodes only the header of the image, the rest of the file is not downloaded
+func imageSize(contentType string, r io.Reader) (int, int, error) {
+	br := bufio.NewReader(r)
+	switch contentType {
+	case "image/png":
+		cfg, err := png.DecodeConfig(br)
+		return cfg.Width, cfg.Height, err
+	case "image/jpeg":
+		cfg, err := jpeg.DecodeConfig(br)
+		return cfg.Width, cfg.Height, err
+	}
+	return 0, 0, errors.New("unsupported image type")
+}
+
+// collectURLs returns a check for every unique URL of the request with the fields using it
+func collectURLs(r *PushBatchRequest) []*URLCheck {
+	byURL := make(map[string]*URLCheck)
+	add := func(url string, field string) {
+		if url == "" {
+			return
+		}
+		c, ok := byURL[url]
+		if !ok {
+			c = &URLCheck{URL: url}
+			byURL[url] = c
+		}
+		if !containsString(c.Fields, field) {
+			c.Fields = append(c.Fields, field)
+		}
+	}
+
+	for _, b := range r.Batch {
+		if b == nil || b.Messages == nil {
+			continue
+		}
+		if a := b.Messages.Android; a != nil && a.Content != nil {
+			add(a.Content.Image, "android.image")
+			add(a.Content.Banner, "android.banner")
+		}
+		if h := b.Messages.Huawei; h != nil && h.Content != nil {
+			add(h.Content.Image, "huawei.image")
+		}
+		if i := b.Messages.IOS; i != nil && i.Content != nil {
+			for _, att := range i.Content.Attachments {
+				if att != nil {
+					add(att.FileURL, "ios.attachments")
+				}
+			}
+		}
+	}
+
+	checks := make([]*URLCheck, 0, len(byURL))
+	for _, c := range byURL {
+		checks = append(checks, c)
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].URL < checks[j].URL
+	})
+	return checks
+}
@@ -0,0 +1,103 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func preflightPush(urls map[string]string) *PushBatchRequest {
+	android := NewAndroidMessage("Title", "Text", false)
+	android.Content.Image = urls["image"]
+	android.Content.Banner = urls["banner"]
+	ios := NewIOSMessage("Title", "Text", false)
+	if urls["attachment"] != "" {
+		ios.Content.Attachments = append(ios.Content.Attachments, &Attachment{FileURL: urls["attachment"]})
+	}
+	r := testPush(IDTypeAppmetricaDeviceID, "1")
+	r.Batch[0].Messages = &Message{Android: android, IOS: ios}
+	return r
+}
+
+func TestPreflightChecks(t *testing.T) {
+	s := newFileServer(t, map[string]*testFile{
+		"/image.png":  {contentType: "image/png", body: pngImage(t, 64, 32)},
+		"/small.png":  {contentType: "image/png", body: pngImage(t, 8, 8)},
+		"/broken.png": {contentType: "image/png", body: []byte("not a png")},
+		"/photo.jpg":  {contentType: "application/octet-stream", body: []byte("jpeg")},
+		"/page.html":  {contentType: "text/html", body: []byte("<html>")},
+		"/login.png":  {contentType: "text/html", body: []byte("<html>sign in</html>")},
+	})
+	p := NewPreflight(NewHTTPURLChecker(s.Client()))
+	p.MinWidth = 16
+	ctx := context.Background()
+
+	tests := []struct {
+		urls map[string]string
+		ok   bool
+	}{
+		{map[string]string{"image": s.URL + "/image.png", "attachment": s.URL + "/photo.jpg"}, true},
+		{map[string]string{"image": s.URL + "/small.png"}, false},
+		{map[string]string{"banner": s.URL + "/broken.png"}, false},
+		{map[string]string{"image": s.URL + "/page.html"}, false},
+		{map[string]string{"attachment": s.URL + "/page.html"}, false},
+		{map[string]string{"attachment": s.URL + "/login.png"}, false},
+		{map[string]string{"image": s.URL + "/missing.png"}, false},
+	}
+	for _, tt := range tests {
+		report := p.Check(ctx, preflightPush(tt.urls))
+		if (report.Err() == nil) != tt.ok {
+			t.Errorf("%v: got %v", tt.urls, report.Err())
+		}
+	}
+
+	report := p.Check(ctx, preflightPush(map[string]string{"image": s.URL + "/image.png"}))
+	if c := report.Checks[0]; c.Width != 64 || c.Height != 32 || c.ContentType != "image/png" {
+		t.Errorf("unexpected check %+v", c)
+	}
+}
+
+func TestPreflightRefuse(t *testing.T) {
+	s := newFileServer(t, map[string]*testFile{})
+	p := NewPreflight(NewHTTPURLChecker(s.Client()))
+	p.Refuse = true
+
+	var sent bool
+	c := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+		sentHandler(w, r)
+	}, WithPushFilters(p))
+	_, err := c.SendPush(preflightPush(map[string]string{"image": s.URL + "/missing.png"}))
+
+	var preflightErr *PreflightError
+	if !errors.As(err, &preflightErr) || len(preflightErr.Failed) != 1 || sent {
+		t.Fatalf("request with missing image should be refused, got %v", err)
+	}
+}
+
+func TestPreflightCache(t *testing.T) {
+	s := newFileServer(t, map[string]*testFile{
+		"/image.png": {contentType: "image/png", body: pngImage(t, 64, 32)},
+	})
+	p := NewPreflight(NewHTTPURLChecker(s.Client()))
+	p.Workers = 4
+
+	requests := make([]*PushBatchRequest, 0)
+	for i := 0; i < 20; i++ {
+		requests = append(requests, preflightPush(map[string]string{"image": s.URL + "/image.png", "banner": s.URL + "/image.png"}))
+	}
+	results := NewBatchSender(newTestClient(sentHandler, WithPushFilters(p)), 4).Send(context.Background(), requests)
+	if err := results.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("/image.png"); n != 1 {
+		t.Fatalf("image is fetched %d times, want 1", n)
+	}
+
+	p.CacheTTL = -1
+	p.Check(context.Background(), requests[0])
+	if n := s.count("/image.png"); n != 2 {
+		t.Fatalf("image is fetched %d times without cache, want 2", n)
+	}
+}
@@ -0,0 +1,128 @@
+package appmetrica_push
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// TimeOfDay is a local wall clock time
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+// DeliveryWindow describes when pushes may be delivered in local time of the device.
+// Quiet hours are [QuietStart, QuietEnd) and may cross midnight, e.g. 22:00-08:00.
+// Equal QuietStart and QuietEnd mean there are no quiet hours.
+type DeliveryWindow struct {
+	At         *TimeOfDay // At is the local time to deliver at. If nil, pushes are delivered as soon as possible
+	QuietStart TimeOfDay  // QuietStart is the start of quiet hours
+	QuietEnd   TimeOfDay  // QuietEnd is the end of quiet hours. Pushes due in quiet hours are delivered at QuietEnd
+}
+
+// ZonedDevice is a device id annotated with IANA time zone
+type ZonedDevice struct {
+	IDType   string // IDType of the device
+	ID       string // ID of the device
+	TimeZone string // TimeZone is IANA time zone name, e.g. Europe/Moscow. Empty means UTC
+}
+
+// ParseTimeOfDay is a function to parse time in 15:04 format
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return TimeOfDay{}, err
+	}
+	return TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
+}
+
+// On is a method to get this time on the date of day in its location
+func (t TimeOfDay) On(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour, t.Minute, 0, 0, day.Location())
+}
+
+func (t TimeOfDay) minutes() int {
+	return t.Hour*60 + t.Minute
+}
+
+// Next is a method to get the earliest delivery time at or after now in loc
+func (w DeliveryWindow) Next(now time.Time, loc *time.Location) time.Time {
+	at := now.In(loc)
+	if w.At != nil {
+		target := w.At.On(at)
+		if target.Before(at) {
+			target = w.At.On(at.AddDate(0, 0, 1))
+		}
+		at = target
+	}
+
+	if w.isQuiet(at) {
+		end := w.QuietEnd.On(at)
+		if end.Before(at) {
+			end = w.QuietEnd.On(at.AddDate(0, 0, 1))
+		}
+		at = end
+	}
+	return at
+}
+
+func (w DeliveryWindow) isQuiet(t time.Time) bool {
+	start, end := w.QuietStart.minutes(), w.QuietEnd.minutes()
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case start == end:
+		return false
+	case start < end:
+		return m >= start && m < end
+	default:
+		return m >= start || m < end
+	}
+}
+
+// ScheduleLocal is a method to split devices into time zone cohorts and schedule requests of every cohort
+// for delivery in the window of its local time. Requests are built by splitter, so the message, group and tag
+// are taken from it. The scheduled pushes are returned ordered by SendAt.
+func (s *Scheduler) ScheduleLocal(splitter *BatchSplitter, devices []*ZonedDevice, w DeliveryWindow) ([]*ScheduledPush, error) {
+	cohorts := make(map[string][]*Device)
+	byType := make(map[string]map[string]*Device)
+	for _, d := range devices {
+		if byType[d.TimeZone] == nil {
+			byType[d.TimeZone] = make(map[string]*Device)
+		}
+		device, ok := byType[d.TimeZone][d.IDType]
+		if !ok {
+			device = NewDevice(d.IDType)
+			byType[d.TimeZone][d.IDType] = device
+			cohorts[d.TimeZone] = append(cohorts[d.TimeZone], device)
+		}
+		device.IDValues = append(device.IDValues, d.ID)
+	}
+
+	now := s.clock().Now()
+	scheduled := make([]*ScheduledPush, 0)
+	for zone, cohort := range cohorts {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("time zone %q: %w", zone, err)
+		}
+		sendAt := w.Next(now, loc)
+		for _, r := range splitter.SplitDevices(cohort) {
+			scheduled = append(scheduled, &ScheduledPush{SendAt: sendAt, TimeZone: zone, Request: r})
+		}
+	}
+
+	sort.Slice(scheduled, func(i, j int) bool {
+		return scheduled[i].SendAt.Before(scheduled[j].SendAt)
+	})
+	for _, p := range scheduled {
+		if err := s.Add(p); err != nil {
+			return nil, err
+		}
+	}
+	return scheduled, nil
+}
@@ -0,0 +1,81 @@
+package appmetrica_push
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiter keyed by group id. It is safe for concurrent use,
+// so one RateLimiter can be shared between several senders and trackers that talk to the same groups.
+type RateLimiter struct {
+	rate  float64 // rate is the number of calls per second allowed for every key
+	burst int     // burst is the maximum number of calls that can be made at once
+
+	mu      sync.Mutex
+	buckets map[int]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates RateLimiter which allows perSecond calls per key with bursts of up to burst calls.
+// A burst less than 1 is treated as 1.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:    perSecond,
+		burst:   burst,
+		buckets: make(map[int]*bucket),
+	}
+}
+
+// Wait blocks until a call for key is allowed or ctx is done.
+// A nil RateLimiter or a non-positive rate never blocks.
+func (l *RateLimiter) Wait(ctx context.Context, key int) error {
+	if l == nil || l.rate <= 0 {
+		return ctx.Err()
+	}
+	for {
+		delay := l.reserve(key)
+		if delay == 0 {
+			return nil
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token for key if one is available, otherwise it returns time to wait for the next one
+func (l *RateLimiter) reserve(key int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
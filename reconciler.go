@@ -0,0 +1,255 @@
+package appmetrica_push
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+type (
+	// DesiredState is a declarative configuration of push groups, e.g. kept in version control.
+	// It can be loaded from JSON with LoadDesiredState or unmarshalled from YAML with any YAML library.
+	DesiredState struct {
+		Apps []*AppSpec `json:"apps" yaml:"apps"` // Apps with their groups
+	}
+
+	// AppSpec is the desired set of groups of one app. Groups of the app which are not declared are archived.
+	AppSpec struct {
+		AppId  int          `json:"app_id" yaml:"app_id"` // AppId is an id of the app
+		Groups []*GroupSpec `json:"groups" yaml:"groups"` // Groups of the app
+	}
+
+	// PlanStep is a single change of the Plan
+	PlanStep struct {
+		Action  GroupAction // Action to take
+		AppId   int         // AppId of the group
+		Current *Group      // Current state of the group. Nil for created groups
+		Desired *GroupSpec  // Desired state of the group. Nil for archived groups
+	}
+
+	// Plan is the list of changes needed to bring groups to the desired state, in order of application
+	Plan []*PlanStep
+
+	// Reconciler brings push groups to the DesiredState.
+	Reconciler struct {
+		Client Client    // Client used to query and change groups
+		DryRun bool      // DryRun prints the plan to Out instead of applying it
+		Out    io.Writer // Out is where the plan is printed in DryRun mode. Default is os.Stdout
+	}
+)
+
+func NewReconciler(client Client) *Reconciler {
+	return &Reconciler{Client: client, Out: os.Stdout}
+}
+
+// LoadDesiredState is a function to read DesiredState from JSON
+func LoadDesiredState(r io.Reader) (*DesiredState, error) {
+	state := &DesiredState{}
+	if err := json.NewDecoder(r).Decode(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Validate is a method to check that app ids are set, group names and ids are unique within the app
+func (s *DesiredState) Validate() error {
+	apps := make(map[int]bool)
+	for _, app := range s.Apps {
+		if app.AppId == 0 {
+			return fmt.Errorf("app_id is required")
+		}
+		if apps[app.AppId] {
+			return fmt.Errorf("app %d is declared twice", app.AppId)
+		}
+		apps[app.AppId] = true
+
+		names := make(map[string]bool)
+		ids := make(map[int]bool)
+		for _, g := range app.Groups {
+			if g.Name == "" {
+				return fmt.Errorf("app %d: group name is required", app.AppId)
+			}
+			if names[g.Name] {
+				return fmt.Errorf("app %d: group %q is declared twice", app.AppId, g.Name)
+			}
+			if g.ID != 0 && ids[g.ID] {
+				return fmt.Errorf("app %d: group id %d is declared twice", app.AppId, g.ID)
+			}
+			names[g.Name] = true
+			ids[g.ID] = true
+		}
+	}
+	return nil
+}
+
+// Plan is a method to diff the desired state against groups returned by GetGroups.
+// Groups are matched by GroupSpec.ID if it is set, so a declared group with another name is renamed,
+// and by name otherwise. Archived groups are looked up by GetGroup to plan their restore.
+func (r *Reconciler) Plan(ctx context.Context, state *DesiredState) (Plan, error) {
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+
+	plan := make(Plan, 0)
+	for _, app := range state.Apps {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		steps, err := r.planApp(app)
+		if err != nil {
+			return nil, fmt.Errorf("app %d: %w", app.AppId, err)
+		}
+		plan = append(plan, steps...)
+	}
+	return plan, nil
+}
+
+func (r *Reconciler) planApp(app *AppSpec) (Plan, error) {
+	groups, err := r.Client.GetGroups(app.AppId)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[int]*Group, len(groups))
+	byName := make(map[string]*Group, len(groups))
+	for _, g := range groups {
+		byId[g.ID] = g
+		byName[g.Name] = g
+	}
+
+	plan := make(Plan, 0)
+	matched := make(map[int]bool, len(app.Groups))
+	for _, spec := range app.Groups {
+		g, ok := byName[spec.Name]
+		if spec.ID != 0 {
+			if ok && g.ID != spec.ID {
+				return nil, fmt.Errorf("group %q is declared with id %d, but has id %d", spec.Name, spec.ID, g.ID)
+			}
+			g, ok = byId[spec.ID]
+		}
+		if ok {
+			if matched[g.ID] {
+				return nil, fmt.Errorf("group %q (id %d) is declared twice", g.Name, g.ID)
+			}
+			matched[g.ID] = true
+			if g.Name != spec.Name || (spec.SendRate != 0 && g.SendRate != spec.SendRate) {
+				plan = append(plan, &PlanStep{Action: GroupActionUpdated, AppId: app.AppId, Current: g, Desired: spec})
+			}
+			continue
+		}
+		if spec.ID == 0 {
+			plan = append(plan, &PlanStep{Action: GroupActionCreated, AppId: app.AppId, Desired: spec})
+			continue
+		}
+
+		archived, err := r.Client.GetGroup(spec.ID)
+		if err != nil {
+			return nil, fmt.Errorf("group %d: %w", spec.ID, err)
+		}
+		if archived.AppId != app.AppId || archived.Name != spec.Name {
+			return nil, fmt.Errorf("archived group %d is %q of app %d, not %q", spec.ID, archived.Name, archived.AppId, spec.Name)
+		}
+		plan = append(plan, &PlanStep{Action: GroupActionRestored, AppId: app.AppId, Current: archived, Desired: spec})
+		if spec.SendRate != 0 && archived.SendRate != spec.SendRate {
+			plan = append(plan, &PlanStep{Action: GroupActionUpdated, AppId: app.AppId, Current: archived, Desired: spec})
+		}
+	}
+
+	for _, g := range groups {
+		if !matched[g.ID] {
+			plan = append(plan, &PlanStep{Action: GroupActionArchived, AppId: app.AppId, Current: g})
+		}
+	}
+	return plan, nil
+}
+
+// Apply is a method to apply the plan step by step. It stops on the first failed step
+// and returns the number of applied steps.
+func (r *Reconciler) Apply(ctx context.Context, plan Plan) (int, error) {
+	for i, step := range plan {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := r.apply(step); err != nil {
+			return i, fmt.Errorf("%s: %w", step, err)
+		}
+	}
+	return len(plan), nil
+}
+
+// Reconcile is a method to plan and apply changes. In DryRun mode the plan is only printed.
+func (r *Reconciler) Reconcile(ctx context.Context, state *DesiredState) (Plan, error) {
+	plan, err := r.Plan(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if r.DryRun {
+		_, err = io.WriteString(r.Out, plan.String())
+		return plan, err
+	}
+	_, err = r.Apply(ctx, plan)
+	return plan, err
+}
+
+func (r *Reconciler) apply(step *PlanStep) error {
+	switch step.Action {
+	case GroupActionCreated:
+		g := NewCreateGroupRequest(step.AppId, step.Desired.Name)
+		g.SendRate = step.Desired.SendRate
+		_, err := r.Client.CreateGroup(g)
+		return err
+	case GroupActionUpdated:
+		g := NewUpdateGroupRequest(step.Desired.Name)
+		g.SendRate = step.Desired.SendRate
+		_, err := r.Client.UpdateGroup(step.Current.ID, g)
+		return err
+	case GroupActionArchived:
+		return r.Client.ArchiveGroup(step.Current.ID)
+	case GroupActionRestored:
+		if err := r.Client.RestoreGroup(step.Desired.ID); err != nil {
+			return err
+		}
+		// the group could be renamed since the plan was made
+		g, err := r.Client.GetGroup(step.Desired.ID)
+		if err != nil {
+			return err
+		}
+		if g.Name != step.Desired.Name {
+			return fmt.Errorf("restored group %d is named %q, not %q", g.ID, g.Name, step.Desired.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", step.Action)
+}
+
+func (s *PlanStep) String() string {
+	switch s.Action {
+	case GroupActionCreated:
+		return fmt.Sprintf("create group %q in app %d with send_rate %d", s.Desired.Name, s.AppId, s.Desired.SendRate)
+	case GroupActionUpdated:
+		if s.Current.Name != s.Desired.Name && s.Desired.SendRate == 0 {
+			return fmt.Sprintf("rename group %q (id %d) in app %d to %q", s.Current.Name, s.Current.ID, s.AppId, s.Desired.Name)
+		}
+		if s.Current.Name != s.Desired.Name {
+			return fmt.Sprintf("rename group %q (id %d) in app %d to %q, send_rate %d -> %d", s.Current.Name, s.Current.ID, s.AppId, s.Desired.Name, s.Current.SendRate, s.Desired.SendRate)
+		}
+		return fmt.Sprintf("update group %q (id %d) in app %d: send_rate %d -> %d", s.Desired.Name, s.Current.ID, s.AppId, s.Current.SendRate, s.Desired.SendRate)
+	case GroupActionArchived:
+		return fmt.Sprintf("archive group %q (id %d) in app %d", s.Current.Name, s.Current.ID, s.AppId)
+	case GroupActionRestored:
+		return fmt.Sprintf("restore group %q (id %d) in app %d", s.Desired.Name, s.Desired.ID, s.AppId)
+	}
+	return string(s.Action)
+}
+
+func (p Plan) String() string {
+	if len(p) == 0 {
+		return "no changes\n"
+	}
+	out := ""
+	for _, step := range p {
+		out += step.String() + "\n"
+	}
+	return out
+}
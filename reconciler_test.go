@@ -0,0 +1,151 @@
+package appmetrica_push
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestReconcilerPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		groups   []*Group
+		archived []int
+		specs    []*GroupSpec
+		want     string
+	}{
+		{
+			name:   "no changes",
+			groups: []*Group{{ID: 1, AppId: 7, Name: "news", SendRate: 1000}},
+			specs:  []*GroupSpec{{Name: "news"}},
+			want:   "no changes\n",
+		},
+		{
+			name:   "create, update and archive",
+			groups: []*Group{{ID: 1, AppId: 7, Name: "news", SendRate: 1000}, {ID: 2, AppId: 7, Name: "old", SendRate: 1000}},
+			specs:  []*GroupSpec{{Name: "news", SendRate: 2000}, {Name: "promo", SendRate: 500}},
+			want: `update group "news" (id 1) in app 7: send_rate 1000 -> 2000
+create group "promo" in app 7 with send_rate 500
+archive group "old" (id 2) in app 7
+`,
+		},
+		{
+			name:   "rename by id",
+			groups: []*Group{{ID: 5, AppId: 7, Name: "old", SendRate: 1000}},
+			specs:  []*GroupSpec{{ID: 5, Name: "new"}},
+			want:   "rename group \"old\" (id 5) in app 7 to \"new\"\n",
+		},
+		{
+			name:     "restore with the same send rate",
+			groups:   []*Group{{ID: 5, AppId: 7, Name: "news", SendRate: 1000}},
+			archived: []int{5},
+			specs:    []*GroupSpec{{ID: 5, Name: "news", SendRate: 1000}},
+			want:     "restore group \"news\" (id 5) in app 7\n",
+		},
+		{
+			name:     "restore with another send rate",
+			groups:   []*Group{{ID: 5, AppId: 7, Name: "news", SendRate: 1000}},
+			archived: []int{5},
+			specs:    []*GroupSpec{{ID: 5, Name: "news", SendRate: 2000}},
+			want: `restore group "news" (id 5) in app 7
+update group "news" (id 5) in app 7: send_rate 1000 -> 2000
+`,
+		},
+		{
+			name:     "restore of another group",
+			groups:   []*Group{{ID: 5, AppId: 7, Name: "news"}},
+			archived: []int{5},
+			specs:    []*GroupSpec{{ID: 5, Name: "promo"}},
+		},
+		{
+			name:   "name taken by another id",
+			groups: []*Group{{ID: 5, AppId: 7, Name: "news"}},
+			specs:  []*GroupSpec{{ID: 6, Name: "news"}},
+		},
+		{
+			name:   "group declared by id and name",
+			groups: []*Group{{ID: 5, AppId: 7, Name: "old"}},
+			specs:  []*GroupSpec{{ID: 5, Name: "new"}, {Name: "old"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newGroupAPI(tt.groups...)
+			for _, id := range tt.archived {
+				api.archived[id] = true
+			}
+			state := &DesiredState{Apps: []*AppSpec{{AppId: 7, Groups: tt.specs}}}
+
+			plan, err := NewReconciler(api).Plan(context.Background(), state)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("plan should fail, got\n%s", plan)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plan.String(); got != tt.want {
+				t.Fatalf("got plan\n%swant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconcilerApply(t *testing.T) {
+	api := newGroupAPI(
+		&Group{ID: 1, AppId: 7, Name: "news", SendRate: 1000},
+		&Group{ID: 2, AppId: 7, Name: "old", SendRate: 1000},
+		&Group{ID: 3, AppId: 7, Name: "sale", SendRate: 1000},
+	)
+	api.archived[3] = true
+	state, err := LoadDesiredState(strings.NewReader(`{"apps":[{"app_id":7,"groups":[
+		{"id":1,"name":"digest","send_rate":2000},
+		{"id":3,"name":"sale","send_rate":500},
+		{"name":"promo"}
+	]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewReconciler(api)
+	if _, err := r.Reconcile(context.Background(), state); err != nil {
+		t.Fatal(err)
+	}
+	groups, _ := api.GetGroups(7)
+	got := make(map[string]int)
+	for _, g := range groups {
+		got[g.Name] = g.SendRate
+	}
+	want := map[string]int{"digest": 2000, "sale": 500, "promo": 0}
+	if len(got) != len(want) {
+		t.Fatalf("got groups %v, want %v", got, want)
+	}
+	for name, rate := range want {
+		if r, ok := got[name]; !ok || r != rate {
+			t.Fatalf("got groups %v, want %v", got, want)
+		}
+	}
+
+	plan, err := r.Plan(context.Background(), state)
+	if err != nil || len(plan) != 0 {
+		t.Fatalf("applied state should need no changes, got %v\n%s", err, plan)
+	}
+}
+
+func TestReconcilerDryRun(t *testing.T) {
+	api := newGroupAPI(&Group{ID: 1, AppId: 7, Name: "news"})
+	var out bytes.Buffer
+	r := NewReconciler(api)
+	r.DryRun = true
+	r.Out = &out
+
+	if _, err := r.Reconcile(context.Background(), &DesiredState{Apps: []*AppSpec{{AppId: 7}}}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "archive group \"news\" (id 1) in app 7\n" || api.archived[1] {
+		t.Fatalf("dry run should only print the plan, got %q", out.String())
+	}
+}
@@ -0,0 +1,154 @@
+package appmetrica_push
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RedirectEnv is the environment variable which turns on redirect mode of every client created by NewClient.
+// The value lists QA devices per IDType, e.g. "ios_push_token=abc,def;appmetrica_device_id=123".
+// If the value is malformed, SendPush fails instead of sending to the original audience.
+const RedirectEnv = "APPMETRICA_PUSH_REDIRECT"
+
+// RedirectCountPlaceholder is replaced with the original audience size in Redirect.TitlePrefix
+const RedirectCountPlaceholder = "{count}"
+
+// defaultRedirectPrefix is the title prefix of redirected pushes
+const defaultRedirectPrefix = "[STAGING original audience=" + RedirectCountPlaceholder + "] "
+
+// errRedirected is passed to push recorders, since the audience of redirected requests gets nothing
+var errRedirected = errors.New("push is redirected to QA devices")
+
+// Redirect sends every push to QA devices instead of its audience, e.g. in staging environments
+// which use real credentials. Devices of every batch are replaced with all QA devices after push filters,
+// and titles get a prefix with the size of the original audience.
+type Redirect struct {
+	Devices     []*Device                                // Devices are the QA devices every push is sent to
+	TitlePrefix string                                   // TitlePrefix of titles, RedirectCountPlaceholder in it is replaced with the original audience size
+	Logf        func(format string, args ...interface{}) // Logf logs the original audience of every redirected push. Default is log.Printf
+
+	err error
+}
+
+func NewRedirect(devices ...*Device) *Redirect {
+	return &Redirect{Devices: devices, TitlePrefix: defaultRedirectPrefix, Logf: log.Printf}
+}
+
+// WithRedirect is an option to send every push to QA devices of the redirect instead of its audience.
+// It takes precedence over RedirectEnv.
+func WithRedirect(r *Redirect) ClientOption {
+	return func(c *client) {
+		c.redirect = r
+	}
+}
+
+// ParseRedirectDevices is a function to parse QA devices in the format of RedirectEnv
+func ParseRedirectDevices(s string) ([]*Device, error) {
+	devices := make([]*Device, 0)
+	for _, group := range strings.Split(s, ";") {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		idType, ids, ok := strings.Cut(group, "=")
+		idType = strings.TrimSpace(idType)
+		if !ok || !isKnownIDType(idType) {
+			return nil, fmt.Errorf("redirect devices %q should be id_type=id,id", group)
+		}
+
+		d := NewDevice(idType)
+		for _, id := range strings.Split(ids, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				d.IDValues = append(d.IDValues, id)
+			}
+		}
+		if len(d.IDValues) == 0 {
+			return nil, fmt.Errorf("redirect devices of %s are empty", idType)
+		}
+		devices = append(devices, d)
+	}
+	if len(devices) == 0 {
+		return nil, errors.New("redirect devices are empty")
+	}
+	return devices, nil
+}
+
+// redirectFromEnv returns the redirect configured by RedirectEnv, nil if it is not set.
+// A malformed value gives a redirect which fails every push.
+func redirectFromEnv() *Redirect {
+	value, ok := os.LookupEnv(RedirectEnv)
+	if !ok {
+		return nil
+	}
+	devices, err := ParseRedirectDevices(value)
+	r := NewRedirect(devices...)
+	if err != nil {
+		r.err = fmt.Errorf("%s: %w", RedirectEnv, err)
+	}
+	return r
+}
+
+// apply returns a copy of the request sent to QA devices with prefixed titles
+func (rd *Redirect) apply(r *PushBatchRequest) (*PushBatchRequest, error) {
+	if rd.err != nil {
+		return nil, rd.err
+	}
+	if countDevices(rd.Devices) == 0 {
+		return nil, errors.New("redirect has no devices")
+	}
+
+	audience := 0
+	for _, b := range r.Batch {
+		if b != nil {
+			audience += countDevices(b.Devices)
+		}
+	}
+	if rd.Logf != nil {
+		rd.Logf("appmetrica: push of group %d with tag %q to %d devices is redirected to %d QA devices",
+			r.GroupID, r.Tag, audience, countDevices(rd.Devices))
+	}
+
+	prefix := strings.Replace(rd.TitlePrefix, RedirectCountPlaceholder, strconv.Itoa(audience), 1)
+
+	redirected := *r
+	redirected.Batch = make([]*Batch, 0, len(r.Batch))
+	for _, b := range r.Batch {
+		if b == nil {
+			continue
+		}
+		batch := &Batch{Messages: prefixTitles(b.Messages, prefix), Devices: make([]*Device, 0, len(rd.Devices))}
+		for _, d := range rd.Devices {
+			batch.Devices = append(batch.Devices, NewDevice(d.IDType, d.IDValues...))
+		}
+		redirected.Batch = append(redirected.Batch, batch)
+	}
+	return &redirected, nil
+}
+
+// prefixTitles returns a copy of the message with prefixed titles of non-silent sections
+func prefixTitles(m *Message, prefix string) *Message {
+	if m == nil || prefix == "" {
+		return m
+	}
+	copied := *m
+	if a := m.Android; a != nil && a.Content != nil && !a.Silent {
+		content := *a.Content
+		content.Title = prefix + content.Title
+		copied.Android = &AndroidMessage{Silent: a.Silent, Content: &content, OpenAction: a.OpenAction}
+	}
+	if i := m.IOS; i != nil && i.Content != nil && !i.Silent {
+		content := *i.Content
+		content.Title = prefix + content.Title
+		copied.IOS = &IOSMessage{Silent: i.Silent, Content: &content, OpenAction: i.OpenAction}
+	}
+	if h := m.Huawei; h != nil && h.Content != nil && !h.Silent {
+		content := *h.Content
+		content.Title = prefix + content.Title
+		copied.Huawei = &HuaweiMessage{Silent: h.Silent, Content: &content, OpenAction: h.OpenAction}
+	}
+	return &copied
+}
@@ -0,0 +1,115 @@
+package appmetrica_push
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRedirectDevices(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []*Device
+		ok    bool
+	}{
+		{"ios_push_token=abc,def", []*Device{NewDevice(IDTypeIOSPushToken, "abc", "def")}, true},
+		{" ios_push_token = abc ; appmetrica_device_id=123;", []*Device{NewDevice(IDTypeIOSPushToken, "abc"), NewDevice(IDTypeAppmetricaDeviceID, "123")}, true},
+		{"", nil, false},
+		{"ios_push_token=", nil, false},
+		{"ios_push_token", nil, false},
+		{"email=qa@example.com", nil, false},
+	}
+	for _, tt := range tests {
+		devices, err := ParseRedirectDevices(tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v", tt.value, err)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(devices, tt.want) {
+			t.Errorf("%q: got %+v", tt.value, devices)
+		}
+	}
+}
+
+func TestRedirectTitlePrefix(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{defaultRedirectPrefix, "[STAGING original audience=3] Sale"},
+		{"[QA 100% {count}] ", "[QA 100% 3] Sale"},
+		{"[QA %d] ", "[QA %d] Sale"},
+		{"", "Sale"},
+	}
+	for _, tt := range tests {
+		rd := NewRedirect(NewDevice(IDTypeIOSPushToken, "qa"))
+		rd.TitlePrefix = tt.prefix
+		rd.Logf = nil
+
+		r := testPush(IDTypeAppmetricaDeviceID, "1", "2", "3")
+		r.Batch[0].Messages = &Message{
+			Android: NewAndroidMessage("Sale", "Text", false),
+			IOS:     NewIOSMessage("Sale", "Text", true),
+		}
+		redirected, err := rd.apply(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := redirected.Batch[0].Messages
+		if m.Android.Content.Title != tt.want || m.IOS.Content.Title != "Sale" {
+			t.Errorf("%q: got titles %q and %q", tt.prefix, m.Android.Content.Title, m.IOS.Content.Title)
+		}
+		if r.Batch[0].Messages.Android.Content.Title != "Sale" {
+			t.Errorf("%q: original request is changed", tt.prefix)
+		}
+	}
+}
+
+func TestRedirectSendsToQADevices(t *testing.T) {
+	capper := NewFrequencyCapper(NewMemoryFrequencyStore(), &FrequencyCap{Limit: 1, Period: time.Hour})
+	rd := NewRedirect(NewDevice(IDTypeIOSPushToken, "qa"))
+	rd.Logf = nil
+
+	var sent []*PushBatchRequest
+	c := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		var body request
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		sent = append(sent, body.PushBatchRequest)
+		sentHandler(w, r)
+	}, WithPushFilters(capper), WithRedirect(rd))
+
+	// the audience gets nothing, so the cap of the real device is not used up
+	for i := 0; i < 2; i++ {
+		if _, err := c.SendPush(testPush(IDTypeAppmetricaDeviceID, "42")); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if len(sent) != 2 {
+		t.Fatalf("got %d sends, want 2", len(sent))
+	}
+	if d := sent[0].Batch[0].Devices; len(d) != 1 || d[0].IDType != IDTypeIOSPushToken || d[0].IDValues[0] != "qa" {
+		t.Fatalf("push is sent to %+v instead of QA devices", d)
+	}
+}
+
+func TestRedirectFromEnv(t *testing.T) {
+	t.Setenv(RedirectEnv, "ios_push_token")
+
+	var sent bool
+	c := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+		sentHandler(w, r)
+	})
+	_, err := c.SendPush(testPush(IDTypeAppmetricaDeviceID, "42"))
+	if err == nil || sent {
+		t.Fatalf("malformed %s should fail the push instead of sending it, got %v", RedirectEnv, err)
+	}
+	if errors.Is(err, errRedirected) {
+		t.Fatal("sentinel of recorders should not reach the caller")
+	}
+}
@@ -0,0 +1,537 @@
+package appmetrica_push
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrScheduleNotFound is returned by ScheduleStore when there is no scheduled push with such id
+var ErrScheduleNotFound = errors.New("scheduled push not found")
+
+// ErrScheduleChanged is returned by ScheduleStore.Update when the push was saved since it was read
+var ErrScheduleChanged = errors.New("scheduled push was changed")
+
+// MissedRunPolicy tells Scheduler what to do with a push which was due while the scheduler was not running
+type MissedRunPolicy string
+
+const (
+	MissedRunCatchUpOnce MissedRunPolicy = "catch_up_once" // Send the push once as soon as possible. This is the default
+	MissedRunSkip        MissedRunPolicy = "skip"          // Don't send the missed push. Recurring push waits for its next run
+)
+
+// ScheduledPush is a push request to be sent at SendAt. If Cron is set, the push is recurring
+// and SendAt is moved to the next run after every run.
+type ScheduledPush struct {
+	ID                   string            `json:"id"`                                // ID of the scheduled push
+	SendAt               time.Time         `json:"send_at"`                           // SendAt is the time of the next run
+	TimeZone             string            `json:"time_zone,omitempty"`               // TimeZone Cron is evaluated in, or of the cohort the request was built for by ScheduleLocal. Empty means UTC
+	Cron                 string            `json:"cron,omitempty"`                    // Cron expression of recurring push, see ParseCron. Empty for one-time push
+	MissedRun            MissedRunPolicy   `json:"missed_run,omitempty"`              // MissedRun policy. Default is MissedRunCatchUpOnce
+	Request              *PushBatchRequest `json:"request"`                           // Request to send
+	Runs                 int               `json:"runs,omitempty"`                    // Runs is the number of runs so far
+	LastClientTransferID int64             `json:"last_client_transfer_id,omitempty"` // LastClientTransferID is the ClientTransferID the last run was sent with
+	Version              int64             `json:"version,omitempty"`                 // Version is increased by the store on every save
+}
+
+// ScheduleStore keeps scheduled pushes, so they survive restarts.
+// Stores keep their own copies of pushes: changes of a push are visible only after it is saved.
+// Save and Update set Version of the saved push to the next one.
+type ScheduleStore interface {
+	Save(p *ScheduledPush) error
+	Get(id string) (*ScheduledPush, error)
+	Delete(id string) error
+	List() ([]*ScheduledPush, error)
+	// Update replaces the push id by p, or deletes it if p is nil, only if the stored push is still of version.
+	// It returns ErrScheduleNotFound if the push was deleted and ErrScheduleChanged if it was saved since.
+	Update(id string, version int64, p *ScheduledPush) error
+}
+
+// MemoryScheduleStore is ScheduleStore kept in memory. It is safe for concurrent use.
+// Pushes are copied on Save, Get and List. Requests of pushes are not copied and should not be changed after saving.
+type MemoryScheduleStore struct {
+	mu     sync.Mutex
+	pushes map[string]*ScheduledPush
+}
+
+// FileScheduleStore is MemoryScheduleStore which keeps every push in a separate JSON file of the directory
+// and loads them on open, so a change rewrites only the file of the changed push.
+// Only one process should use the directory at a time.
+type FileScheduleStore struct {
+	*MemoryScheduleStore
+
+	dir    string
+	fileMu sync.Mutex
+}
+
+// Scheduler sends scheduled pushes when they are due.
+type Scheduler struct {
+	Client       Client                                               // Client used to send pushes
+	Store        ScheduleStore                                        // Store of scheduled pushes
+	Clock        Clock                                                // Clock of the scheduler. Default is SystemClock
+	PollInterval time.Duration                                        // PollInterval is the longest time between checks of Store. Default is 1 minute
+	MissedGrace  time.Duration                                        // MissedGrace is how late a run can be before it is considered missed. Default is PollInterval
+	OnSent       func(p *ScheduledPush, res *PushResponse, err error) // OnSent is called after every send
+
+	wake chan struct{}
+}
+
+func NewScheduler(client Client, store ScheduleStore) *Scheduler {
+	return &Scheduler{
+		Client:       client,
+		Store:        store,
+		Clock:        SystemClock,
+		PollInterval: time.Minute,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{pushes: make(map[string]*ScheduledPush)}
+}
+
+// OpenFileScheduleStore is a function to open the store in dir, creating the directory if it doesn't exist
+func OpenFileScheduleStore(dir string) (*FileScheduleStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileScheduleStore{MemoryScheduleStore: NewMemoryScheduleStore(), dir: dir}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		p := &ScheduledPush{}
+		if err := json.Unmarshal(data, p); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		s.pushes[p.ID] = p
+	}
+	return s, nil
+}
+
+// Add is a method to save the push to the store. The push gets an ID if it has none.
+func (s *Scheduler) Add(p *ScheduledPush) error {
+	if p.ID == "" {
+		p.ID = newScheduleID()
+	}
+	if err := s.Store.Save(p); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Run is a method to send due pushes until ctx is done. Sent pushes are deleted from the store,
+// the outcome is reported to OnSent.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		next, err := s.sendDue(ctx)
+		if err != nil {
+			return err
+		}
+
+		wait := s.PollInterval
+		if wait <= 0 {
+			wait = time.Minute
+		}
+		if !next.IsZero() {
+			if untilNext := next.Sub(s.clock().Now()); untilNext < wait {
+				wait = untilNext
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+		case <-s.clock().After(wait):
+		}
+	}
+}
+
+// sendDue sends pushes due by now and returns the send time of the earliest remaining one
+func (s *Scheduler) sendDue(ctx context.Context) (time.Time, error) {
+	pushes, err := s.Store.List()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	for _, p := range pushes {
+		if ctx.Err() != nil {
+			return time.Time{}, nil
+		}
+
+		now := s.clock().Now()
+		if p.SendAt.After(now) {
+			if next.IsZero() || p.SendAt.Before(next) {
+				next = p.SendAt
+			}
+			continue
+		}
+
+		run, err := s.advance(p, now)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if p.Cron != "" && !p.SendAt.IsZero() && (next.IsZero() || p.SendAt.Before(next)) {
+			next = p.SendAt
+		}
+		if run == nil {
+			continue
+		}
+
+		res, err := s.Client.SendPush(run)
+		if s.OnSent != nil {
+			s.OnSent(p, res, err)
+		}
+	}
+	return next, nil
+}
+
+// advance saves the state of the push after the due run before it is sent, so the run is never sent twice
+// after a restart. It returns the request to send, or nil if the run is skipped. The push may be cancelled
+// or changed since it was listed, then its stale run is skipped as well and the next pass sees the change.
+func (s *Scheduler) advance(p *ScheduledPush, now time.Time) (*PushBatchRequest, error) {
+	grace := s.MissedGrace
+	if grace <= 0 {
+		grace = s.PollInterval
+	}
+	missed := now.Sub(p.SendAt) > grace
+	runAt := p.SendAt
+	version := p.Version
+
+	next := p
+	if p.Cron == "" {
+		next = nil
+	} else {
+		cron, loc, err := p.schedule()
+		if err != nil {
+			return nil, err
+		}
+		// catching up sends only one run however many were missed
+		p.SendAt = cron.Next(now.In(loc))
+		if p.SendAt.IsZero() {
+			next = nil
+		}
+	}
+
+	var run *PushBatchRequest
+	if !missed || p.MissedRun != MissedRunSkip {
+		r := *p.Request
+		if p.Cron != "" || r.ClientTransferID == 0 {
+			r.ClientTransferID = deriveClientTransferID(p.ID, runAt)
+		}
+		p.Runs++
+		p.LastClientTransferID = r.ClientTransferID
+		run = &r
+	}
+
+	err := s.Store.Update(p.ID, version, next)
+	if errors.Is(err, ErrScheduleNotFound) || errors.Is(err, ErrScheduleChanged) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// ScheduleAt is a method to schedule a one-time send of the request
+func (s *Scheduler) ScheduleAt(r *PushBatchRequest, at time.Time) (*ScheduledPush, error) {
+	p := &ScheduledPush{SendAt: at, Request: r}
+	return p, s.Add(p)
+}
+
+// ScheduleCron is a method to schedule recurring sends of the request by cron expression evaluated in loc,
+// e.g. "0 10 * * MON" for every Monday at 10:00. Nil loc means UTC.
+func (s *Scheduler) ScheduleCron(r *PushBatchRequest, spec string, loc *time.Location) (*ScheduledPush, error) {
+	p := &ScheduledPush{Cron: spec, Request: r}
+	if loc != nil {
+		p.TimeZone = loc.String()
+	}
+	if err := s.setNextRun(p); err != nil {
+		return nil, err
+	}
+	return p, s.Add(p)
+}
+
+// List is a method to get all scheduled pushes ordered by SendAt
+func (s *Scheduler) List() ([]*ScheduledPush, error) {
+	return s.Store.List()
+}
+
+// Cancel is a method to remove the scheduled push
+func (s *Scheduler) Cancel(id string) error {
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+// Reschedule is a method to move the next run of the push to at. Later runs of recurring push follow its Cron.
+func (s *Scheduler) Reschedule(id string, at time.Time) error {
+	return s.update(id, func(p *ScheduledPush) error {
+		p.SendAt = at
+		return nil
+	})
+}
+
+// RescheduleCron is a method to change cron expression of the push. The push becomes recurring if it wasn't.
+func (s *Scheduler) RescheduleCron(id string, spec string) error {
+	return s.update(id, func(p *ScheduledPush) error {
+		p.Cron = spec
+		return s.setNextRun(p)
+	})
+}
+
+// update applies change to the stored push and saves it. The change is applied again
+// to the new state of the push if it was saved meanwhile, e.g. advanced by Run.
+func (s *Scheduler) update(id string, change func(p *ScheduledPush) error) error {
+	for {
+		p, err := s.Store.Get(id)
+		if err != nil {
+			return err
+		}
+		version := p.Version
+		if err := change(p); err != nil {
+			return err
+		}
+		err = s.Store.Update(id, version, p)
+		if errors.Is(err, ErrScheduleChanged) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.notify()
+		return nil
+	}
+}
+
+// setNextRun sets SendAt of recurring push to its next run after now
+func (s *Scheduler) setNextRun(p *ScheduledPush) error {
+	cron, loc, err := p.schedule()
+	if err != nil {
+		return err
+	}
+	p.SendAt = cron.Next(s.clock().Now().In(loc))
+	if p.SendAt.IsZero() {
+		return fmt.Errorf("cron expression %q never matches", p.Cron)
+	}
+	return nil
+}
+
+// schedule parses Cron and TimeZone of the push
+func (p *ScheduledPush) schedule() (*CronSchedule, *time.Location, error) {
+	cron, err := ParseCron(p.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cron, loc, nil
+}
+
+func (p *ScheduledPush) copy() *ScheduledPush {
+	copied := *p
+	return &copied
+}
+
+// deriveClientTransferID returns a positive id which is the same for the same run of the push,
+// so every run can be tracked by GetStatusByClientTransferId
+func deriveClientTransferID(id string, runAt time.Time) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	h.Write([]byte(strconv.FormatInt(runAt.Unix(), 10)))
+	return int64(h.Sum64()&math.MaxInt64) | 1
+}
+
+func (s *Scheduler) clock() Clock {
+	if s.Clock == nil {
+		return SystemClock
+	}
+	return s.Clock
+}
+
+// notify wakes Run up to check the store
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *MemoryScheduleStore) Save(p *ScheduledPush) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.Version = s.version(p.ID) + 1
+	s.pushes[p.ID] = p.copy()
+	return nil
+}
+
+func (s *MemoryScheduleStore) Update(id string, version int64, p *ScheduledPush) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(id, version); err != nil {
+		return err
+	}
+	if p == nil {
+		delete(s.pushes, id)
+		return nil
+	}
+	p.Version = version + 1
+	s.pushes[id] = p.copy()
+	return nil
+}
+
+// check returns an error if the push id is not of version. s.mu must be held.
+func (s *MemoryScheduleStore) check(id string, version int64) error {
+	stored, ok := s.pushes[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	if stored.Version != version {
+		return ErrScheduleChanged
+	}
+	return nil
+}
+
+// version returns the version of the push id, or 0 if there is no such push. s.mu must be held.
+func (s *MemoryScheduleStore) version(id string) int64 {
+	if p, ok := s.pushes[id]; ok {
+		return p.Version
+	}
+	return 0
+}
+
+func (s *MemoryScheduleStore) Get(id string) (*ScheduledPush, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pushes[id]
+	if !ok {
+		return nil, ErrScheduleNotFound
+	}
+	return p.copy(), nil
+}
+
+func (s *MemoryScheduleStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pushes[id]; !ok {
+		return ErrScheduleNotFound
+	}
+	delete(s.pushes, id)
+	return nil
+}
+
+// List is a method to get all scheduled pushes ordered by SendAt
+func (s *MemoryScheduleStore) List() ([]*ScheduledPush, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pushes := make([]*ScheduledPush, 0, len(s.pushes))
+	for _, p := range s.pushes {
+		pushes = append(pushes, p.copy())
+	}
+	sort.Slice(pushes, func(i, j int) bool {
+		return pushes[i].SendAt.Before(pushes[j].SendAt)
+	})
+	return pushes, nil
+}
+
+// Save and Update write the file while holding fileMu, so the version check and the write are atomic
+func (s *FileScheduleStore) Save(p *ScheduledPush) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	s.mu.Lock()
+	version := s.version(p.ID)
+	s.mu.Unlock()
+	if err := s.write(p, version+1); err != nil {
+		return err
+	}
+	return s.MemoryScheduleStore.Save(p)
+}
+
+func (s *FileScheduleStore) Update(id string, version int64, p *ScheduledPush) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	s.mu.Lock()
+	err := s.check(id, version)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		if err := s.remove(id); err != nil {
+			return err
+		}
+	} else if err := s.write(p, version+1); err != nil {
+		return err
+	}
+	return s.MemoryScheduleStore.Update(id, version, p)
+}
+
+func (s *FileScheduleStore) Delete(id string) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := s.MemoryScheduleStore.Delete(id); err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+// write replaces the file of the push atomically, so a crash leaves either the old or the new push
+func (s *FileScheduleStore) write(p *ScheduledPush, version int64) error {
+	saved := p.copy()
+	saved.Version = version
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	file := s.file(p.ID)
+	if err := os.WriteFile(file+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func (s *FileScheduleStore) remove(id string) error {
+	if err := os.Remove(s.file(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// file returns the path of the push file, ids are escaped so they can't point outside of the directory
+func (s *FileScheduleStore) file(id string) string {
+	return filepath.Join(s.dir, url.PathEscape(id)+".json")
+}
+
+func newScheduleID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
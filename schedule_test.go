@@ -0,0 +1,334 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is Clock which moves only by Advance
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{at: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- c.now
+		return w.ch
+	}
+	c.waiters = append(c.waiters, w)
+	return w.ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiting := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+type sentPush struct {
+	push *ScheduledPush
+	err  error
+}
+
+func startScheduler(t *testing.T, store ScheduleStore, clock *fakeClock) (*Scheduler, <-chan sentPush) {
+	t.Helper()
+	sent := make(chan sentPush, 16)
+	s := NewScheduler(newTestClient(sentHandler), store)
+	s.Clock = clock
+	s.OnSent = func(p *ScheduledPush, _ *PushResponse, err error) {
+		sent <- sentPush{push: p, err: err}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return s, sent
+}
+
+// waitSent advances the clock by step until a push is sent
+func waitSent(t *testing.T, clock *fakeClock, sent <-chan sentPush, step time.Duration) sentPush {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p := <-sent:
+			if p.err != nil {
+				t.Fatal(p.err)
+			}
+			return p
+		case <-timeout:
+			t.Fatal("push is not sent")
+		case <-time.After(time.Millisecond):
+			clock.Advance(step)
+		}
+	}
+}
+
+func TestSchedulerSendsOnce(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	store := NewMemoryScheduleStore()
+	s, sent := startScheduler(t, store, clock)
+
+	p, err := s.ScheduleAt(testPush(IDTypeAppmetricaDeviceID, "1"), start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := waitSent(t, clock, sent, time.Minute)
+	if got.push.ID != p.ID || clock.Now().Before(p.SendAt) {
+		t.Fatalf("push %s sent at %s, scheduled at %s", got.push.ID, clock.Now(), p.SendAt)
+	}
+	if _, err := store.Get(p.ID); err != ErrScheduleNotFound {
+		t.Fatalf("sent one-time push should be deleted, got %v", err)
+	}
+}
+
+func TestSchedulerCronRuns(t *testing.T) {
+	loc := mustLoadLocation(t, "America/New_York")
+	start := time.Date(2026, 10, 31, 12, 0, 0, 0, loc)
+	clock := newFakeClock(start)
+	s, sent := startScheduler(t, NewMemoryScheduleStore(), clock)
+
+	if _, err := s.ScheduleCron(testPush(IDTypeAppmetricaDeviceID, "1"), "30 1 * * *", loc); err != nil {
+		t.Fatal(err)
+	}
+	first := waitSent(t, clock, sent, 10*time.Minute)
+	second := waitSent(t, clock, sent, 10*time.Minute)
+
+	if first.push.LastClientTransferID == second.push.LastClientTransferID {
+		t.Fatal("every run should have its own client transfer id")
+	}
+	if second.push.Runs != 2 || clock.Now().Before(time.Date(2026, 11, 2, 1, 30, 0, 0, loc)) {
+		t.Fatalf("repeated wall time should run once, run %d at %s", second.push.Runs, clock.Now())
+	}
+}
+
+func TestSchedulerSkipsMissedRun(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	store := NewMemoryScheduleStore()
+	store.Save(&ScheduledPush{ID: "missed", SendAt: start.Add(-time.Hour), MissedRun: MissedRunSkip, Request: testPush(IDTypeAppmetricaDeviceID, "1")})
+	store.Save(&ScheduledPush{ID: "late", SendAt: start.Add(-time.Hour), Request: testPush(IDTypeAppmetricaDeviceID, "1")})
+
+	clock := newFakeClock(start)
+	_, sent := startScheduler(t, store, clock)
+	if got := waitSent(t, clock, sent, time.Minute); got.push.ID != "late" {
+		t.Fatalf("missed push %s is sent", got.push.ID)
+	}
+	if pushes, _ := store.List(); len(pushes) != 0 {
+		t.Fatalf("missed one-time push should be dropped, left %d", len(pushes))
+	}
+}
+
+func TestSchedulerRescheduleWhileRunning(t *testing.T) {
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+	s, sent := startScheduler(t, NewMemoryScheduleStore(), clock)
+
+	p, err := s.ScheduleCron(testPush(IDTypeAppmetricaDeviceID, "1"), "*/5 * * * *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := s.Reschedule(p.ID, clock.Now()); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		waitSent(t, clock, sent, time.Minute)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// sendDueWith runs one pass of the scheduler over pushes due at now and calls onSent after every send
+func sendDueWith(t *testing.T, store ScheduleStore, now time.Time, onSent func(s *Scheduler, p *ScheduledPush)) []string {
+	t.Helper()
+	s := NewScheduler(newTestClient(sentHandler), store)
+	s.Clock = newFakeClock(now)
+	sent := make([]string, 0)
+	s.OnSent = func(p *ScheduledPush, _ *PushResponse, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, p.ID)
+		onSent(s, p)
+	}
+	if _, err := s.sendDue(context.Background()); err != nil {
+		t.Fatalf("pass failed: %v", err)
+	}
+	return sent
+}
+
+func TestSchedulerCancelDuringRun(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	store := NewMemoryScheduleStore()
+	store.Save(&ScheduledPush{ID: "first", SendAt: now.Add(-2 * time.Minute), Request: testPush(IDTypeAppmetricaDeviceID, "1")})
+	store.Save(&ScheduledPush{ID: "once", SendAt: now.Add(-time.Minute), Request: testPush(IDTypeAppmetricaDeviceID, "2")})
+	store.Save(&ScheduledPush{ID: "cron", SendAt: now.Add(-time.Minute), Cron: "*/5 * * * *", Request: testPush(IDTypeAppmetricaDeviceID, "3")})
+
+	sent := sendDueWith(t, store, now, func(s *Scheduler, p *ScheduledPush) {
+		if p.ID != "first" {
+			return
+		}
+		for _, id := range []string{"once", "cron"} {
+			if err := s.Cancel(id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if len(sent) != 1 {
+		t.Fatalf("cancelled pushes are sent: %v", sent)
+	}
+	if pushes, _ := store.List(); len(pushes) != 0 {
+		t.Fatalf("cancelled pushes are saved back, left %d", len(pushes))
+	}
+}
+
+func TestSchedulerRescheduleDuringRun(t *testing.T) {
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	later := now.Add(time.Hour)
+	store := NewMemoryScheduleStore()
+	store.Save(&ScheduledPush{ID: "first", SendAt: now.Add(-2 * time.Minute), Request: testPush(IDTypeAppmetricaDeviceID, "1")})
+	store.Save(&ScheduledPush{ID: "cron", SendAt: now.Add(-time.Minute), Cron: "*/5 * * * *", Request: testPush(IDTypeAppmetricaDeviceID, "2")})
+
+	sent := sendDueWith(t, store, now, func(s *Scheduler, p *ScheduledPush) {
+		if p.ID == "first" {
+			if err := s.Reschedule("cron", later); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if len(sent) != 1 {
+		t.Fatalf("rescheduled push is sent at the old time: %v", sent)
+	}
+	p, err := store.Get("cron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.SendAt.Equal(later) || p.Runs != 0 {
+		t.Fatalf("reschedule is overwritten: send at %s after %d runs", p.SendAt, p.Runs)
+	}
+}
+
+func TestFileScheduleStoreUpdate(t *testing.T) {
+	store, err := OpenFileScheduleStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &ScheduledPush{ID: "a", Request: testPush(IDTypeAppmetricaDeviceID, "1")}
+	if err := store.Save(p); err != nil {
+		t.Fatal(err)
+	}
+	stale := p.Version
+	if err := store.Save(p); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		version int64
+		want    error
+	}{
+		{"stale version", "a", stale, ErrScheduleChanged},
+		{"deleted push", "b", 1, ErrScheduleNotFound},
+		{"current version", "a", p.Version, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.Update(tt.id, tt.version, nil); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if _, err := store.Get("a"); err != ErrScheduleNotFound {
+		t.Fatalf("push should be deleted, got %v", err)
+	}
+}
+
+func TestFileScheduleStoreReopen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "schedule")
+	store, err := OpenFileScheduleStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	for _, id := range []string{"a", "b", "../c"} {
+		if err := store.Save(&ScheduledPush{ID: id, SendAt: at, Request: testPush(IDTypeAppmetricaDeviceID, "1")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenFileScheduleStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := reopened.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.SendAt.Equal(at) || p.Request.Batch[0].Devices[0].IDValues[0] != "1" {
+		t.Fatalf("unexpected push %+v", p)
+	}
+	if pushes, _ := reopened.List(); len(pushes) != 2 {
+		t.Fatalf("reopened store has %d pushes, want 2", len(pushes))
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 2 {
+		t.Fatalf("store directory has %d files, want 2", len(files))
+	}
+}
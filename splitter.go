@@ -0,0 +1,138 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// BatchSplitter splits an audience into PushBatchRequest which fit into limits of a single request:
+// at most MaxDevices devices in at most MaxDeviceGroupsPerRequest id_type groups.
+type BatchSplitter struct {
+	GroupID     int                   // GroupID of every request
+	Tag         string                // Tag of every request
+	Message     *Message              // Message sent to every device
+	MaxDevices  int                   // MaxDevices in one request. Default is MaxDevicesPerRequest
+	OnMalformed func(*RowError) error // OnMalformed is called for malformed rows, returned error stops splitting. If nil, splitting stops on the first malformed row
+}
+
+// batchBuilder accumulates devices of one request
+type batchBuilder struct {
+	splitter *BatchSplitter
+	devices  []*Device
+	byType   map[string]*Device
+	count    int
+}
+
+func NewBatchSplitter(groupId int, tag string, message *Message) *BatchSplitter {
+	return &BatchSplitter{GroupID: groupId, Tag: tag, Message: message, MaxDevices: MaxDevicesPerRequest}
+}
+
+// Split is a method to read devices from r and send the requests to out as soon as they are full,
+// so at most one request is kept in memory. It doesn't close out.
+func (s *BatchSplitter) Split(ctx context.Context, r DeviceReader, out chan<- *PushBatchRequest) error {
+	b := s.newBuilder()
+	emit := func(req *PushBatchRequest) error {
+		if req == nil {
+			return nil
+		}
+		select {
+		case out <- req:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		d, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			if s.OnMalformed == nil {
+				return rowErr
+			}
+			if err := s.OnMalformed(rowErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, id := range d.IDValues {
+			if err := emit(b.add(d.IDType, id)); err != nil {
+				return err
+			}
+		}
+	}
+	return emit(b.flush())
+}
+
+// SplitDevices is a method to split devices which are already in memory
+func (s *BatchSplitter) SplitDevices(devices []*Device) []*PushBatchRequest {
+	b := s.newBuilder()
+	requests := make([]*PushBatchRequest, 0)
+	for _, d := range devices {
+		for _, id := range d.IDValues {
+			if req := b.add(d.IDType, id); req != nil {
+				requests = append(requests, req)
+			}
+		}
+	}
+	if req := b.flush(); req != nil {
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+func (s *BatchSplitter) newBuilder() *batchBuilder {
+	return &batchBuilder{splitter: s, byType: make(map[string]*Device)}
+}
+
+// add appends the device id and returns the previous request if it had to be flushed to make room
+func (b *batchBuilder) add(idType string, id string) *PushBatchRequest {
+	maxDevices := b.splitter.MaxDevices
+	if maxDevices <= 0 {
+		maxDevices = MaxDevicesPerRequest
+	}
+
+	var full *PushBatchRequest
+	_, hasType := b.byType[idType]
+	if b.count >= maxDevices || (!hasType && len(b.devices) >= MaxDeviceGroupsPerRequest) {
+		full = b.flush()
+	}
+
+	d, ok := b.byType[idType]
+	if !ok {
+		d = NewDevice(idType)
+		b.byType[idType] = d
+		b.devices = append(b.devices, d)
+	}
+	d.IDValues = append(d.IDValues, id)
+	b.count++
+
+	return full
+}
+
+// flush returns the accumulated request and resets the builder. It returns nil if there are no devices.
+func (b *batchBuilder) flush() *PushBatchRequest {
+	if b.count == 0 {
+		return nil
+	}
+
+	batch := NewBatch()
+	batch.Messages = b.splitter.Message
+	batch.Devices = b.devices
+
+	req := NewPushBatchRequestBody(b.splitter.GroupID, b.splitter.Tag)
+	req.Batch = append(req.Batch, batch)
+
+	b.devices = nil
+	b.byType = make(map[string]*Device)
+	b.count = 0
+	return req
+}
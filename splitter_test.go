@@ -0,0 +1,89 @@
+package appmetrica_push
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestBatchSplitterSplit(t *testing.T) {
+	rows := make([]string, 0)
+	for i := 1; i <= 25; i++ {
+		rows = append(rows, strconv.Itoa(i))
+	}
+	rows = append(rows, `""`)
+
+	tests := []struct {
+		name       string
+		maxDevices int
+		requests   []int
+	}{
+		{"default limit", 0, []int{25}},
+		{"full requests", 10, []int{10, 10, 5}},
+		{"exact fit", 25, []int{25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewBatchSplitter(1, "promo", &Message{})
+			s.MaxDevices = tt.maxDevices
+			malformed := make([]int, 0)
+			s.OnMalformed = func(e *RowError) error {
+				malformed = append(malformed, e.Line)
+				return nil
+			}
+			r := NewCSVDeviceReader(strings.NewReader("id\n"+strings.Join(rows, "\n")), "id", IDTypeAppmetricaDeviceID)
+
+			out := make(chan *PushBatchRequest, 10)
+			if err := s.Split(context.Background(), r, out); err != nil {
+				t.Fatal(err)
+			}
+			close(out)
+			sizes := make([]int, 0)
+			for req := range out {
+				if req.GroupID != 1 || req.Tag != "promo" {
+					t.Fatalf("unexpected request %+v", req)
+				}
+				n := 0
+				for _, d := range req.Batch[0].Devices {
+					n += len(d.IDValues)
+				}
+				sizes = append(sizes, n)
+			}
+			if !reflect.DeepEqual(sizes, tt.requests) {
+				t.Fatalf("got requests of %v devices, want %v", sizes, tt.requests)
+			}
+			if !reflect.DeepEqual(malformed, []int{27}) {
+				t.Fatalf("got malformed lines %v, want the empty id only", malformed)
+			}
+		})
+	}
+}
+
+func TestBatchSplitterStopsOnMalformed(t *testing.T) {
+	s := NewBatchSplitter(1, "promo", &Message{})
+	r := NewLineDeviceReader(strings.NewReader("1\n2\n"), "email")
+	out := make(chan *PushBatchRequest, 1)
+	if err := s.Split(context.Background(), r, out); err == nil || len(out) != 0 {
+		t.Fatalf("malformed row without OnMalformed should stop splitting, got %v", err)
+	}
+}
+
+func TestBatchSplitterDeviceGroups(t *testing.T) {
+	types := []string{IDTypeAppmetricaDeviceID, IDTypeIOSIFA, IDTypeGoogleAID, IDTypeAndroidPushToken,
+		IDTypeIOSPushToken, IDTypeHuaweiPushToken, IDTypeHuaweiOAID}
+	devices := make([]*Device, 0)
+	for _, idType := range types {
+		devices = append(devices, NewDevice(idType, "a", "b"))
+	}
+
+	requests := NewBatchSplitter(1, "promo", &Message{}).SplitDevices(devices)
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	groups := []int{len(requests[0].Batch[0].Devices), len(requests[1].Batch[0].Devices)}
+	if !reflect.DeepEqual(groups, []int{MaxDeviceGroupsPerRequest, len(types) - MaxDeviceGroupsPerRequest}) {
+		t.Fatalf("got %v id type groups per request", groups)
+	}
+}
@@ -0,0 +1,206 @@
+package appmetrica_push
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+)
+
+// SuppressionStore holds device ids which must never get pushes, e.g. users who opted out.
+// Ids are passed normalized with NormalizeDeviceID when possible.
+type SuppressionStore interface {
+	Contains(idType string, id string) (bool, error)
+}
+
+// SuppressionList is a SuppressionStore applied to requests matching its scope
+type SuppressionList struct {
+	Store  SuppressionStore // Store of suppressed ids
+	Tags   []string         // Tags the list applies to. Empty means every tag
+	Groups []int            // Groups the list applies to. Empty means every group
+}
+
+// SuppressionReport describes devices removed from a request by Suppressor
+type SuppressionReport struct {
+	Total          int            // Total number of devices checked
+	Suppressed     map[string]int // Suppressed is the number of removed devices per IDType
+	DroppedBatches int            // DroppedBatches is the number of batches left without devices and removed from the request
+}
+
+// Suppressor removes suppressed devices from requests. It implements PushFilter, so it can be
+// consulted by the client before every SendPush, see WithPushFilters.
+type Suppressor struct {
+	Lists    []*SuppressionList                                   // Lists consulted for every request
+	OnReport func(r *PushBatchRequest, report *SuppressionReport) // OnReport is called by FilterPush for every filtered request
+}
+
+// MemorySuppressionStore is SuppressionStore kept in memory. It is safe for concurrent use.
+type MemorySuppressionStore struct {
+	mu  sync.RWMutex
+	ids map[string]map[string]struct{}
+}
+
+func NewSuppressor(lists ...*SuppressionList) *Suppressor {
+	return &Suppressor{Lists: lists}
+}
+
+func NewSuppressionList(store SuppressionStore) *SuppressionList {
+	return &SuppressionList{Store: store}
+}
+
+func NewMemorySuppressionStore() *MemorySuppressionStore {
+	return &MemorySuppressionStore{ids: make(map[string]map[string]struct{})}
+}
+
+// ReadSuppressionStore is a function to load all devices from DeviceReader into MemorySuppressionStore.
+// Reading stops on the first error, including malformed rows.
+func ReadSuppressionStore(r DeviceReader) (*MemorySuppressionStore, error) {
+	s := NewMemorySuppressionStore()
+	for {
+		d, err := r.Read()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.Add(d.IDType, d.IDValues...)
+	}
+}
+
+// LoadSuppressionFile is a function to load suppressed devices from CSV file with id_type and id_value columns
+func LoadSuppressionFile(path string) (*MemorySuppressionStore, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := NewCSVDeviceReader(f, "id_value", "")
+	r.IDTypeColumn = "id_type"
+	return ReadSuppressionStore(r)
+}
+
+// Add is a method to suppress ids of idType
+func (s *MemorySuppressionStore) Add(idType string, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids[idType] == nil {
+		s.ids[idType] = make(map[string]struct{})
+	}
+	for _, id := range ids {
+		s.ids[idType][deviceKey(idType, id)] = struct{}{}
+	}
+}
+
+// Remove is a method to stop suppressing ids of idType
+func (s *MemorySuppressionStore) Remove(idType string, ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.ids[idType], deviceKey(idType, id))
+	}
+}
+
+func (s *MemorySuppressionStore) Contains(idType string, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.ids[idType][deviceKey(idType, id)]
+	return ok, nil
+}
+
+// Len is a method to get the number of suppressed ids
+func (s *MemorySuppressionStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, ids := range s.ids {
+		n += len(ids)
+	}
+	return n
+}
+
+// Filter is a method to remove suppressed devices from the request in place.
+// Batches left without devices are removed from the request.
+func (s *Suppressor) Filter(r *PushBatchRequest) (*SuppressionReport, error) {
+	report := &SuppressionReport{Suppressed: make(map[string]int)}
+
+	lists := make([]*SuppressionList, 0, len(s.Lists))
+	for _, l := range s.Lists {
+		if inScope(r, l.Tags, l.Groups) {
+			lists = append(lists, l)
+		}
+	}
+
+	dropped, err := filterDevices(r, func(idType string, id string) (bool, error) {
+		report.Total++
+		suppressed, err := isSuppressed(lists, idType, deviceKey(idType, id))
+		if suppressed {
+			report.Suppressed[idType]++
+		}
+		return !suppressed, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.DroppedBatches = dropped
+	return report, nil
+}
+
+func (s *Suppressor) FilterPush(_ context.Context, r *PushBatchRequest) error {
+	report, err := s.Filter(r)
+	if err != nil {
+		return err
+	}
+	if s.OnReport != nil {
+		s.OnReport(r, report)
+	}
+	return nil
+}
+
+// SuppressedTotal is a method to get the number of removed devices of all types
+func (r *SuppressionReport) SuppressedTotal() int {
+	n := 0
+	for _, c := range r.Suppressed {
+		n += c
+	}
+	return n
+}
+
+func isSuppressed(lists []*SuppressionList, idType string, id string) (bool, error) {
+	for _, l := range lists {
+		ok, err := l.Store.Contains(idType, id)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func withoutEmptyDevices(devices []*Device) []*Device {
+	out := devices[:0]
+	for _, d := range devices {
+		if d != nil && len(d.IDValues) > 0 {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, v int) bool {
+	for _, i := range values {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
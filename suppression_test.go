@@ -0,0 +1,19 @@
+package appmetrica_push
+
+import "testing"
+
+func TestSuppressorFilter(t *testing.T) {
+	store := NewMemorySuppressionStore()
+	store.Add(IDTypeIOSPushToken, "AB")
+	list := NewSuppressionList(store)
+	list.Groups = []int{1}
+
+	r := testPush(IDTypeIOSPushToken, "ab ", "cd")
+	report, err := NewSuppressor(list).Filter(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.SuppressedTotal() != 1 || report.Total != 2 || r.Batch[0].Devices[0].IDValues[0] != "cd" {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,218 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTrackerRunning is returned by TransferTracker.Run when the tracker is already running
+var ErrTrackerRunning = errors.New("transfer tracker is already running")
+
+// ErrEmptyTransfer is published as the polling error when the status response has no transfer.
+// The dispatch stays tracked and is polled again.
+var ErrEmptyTransfer = errors.New("empty transfer in response")
+
+// trackerBuffer is the number of updates buffered in the Updates channel
+const trackerBuffer = 64
+
+// TransferKey identifies a tracked dispatch. Either TransferId or GroupId and ClientTransferId are set.
+type TransferKey struct {
+	TransferId       int   // TransferId returned in PushResponse
+	GroupId          int   // GroupId of the dispatch, used together with ClientTransferId
+	ClientTransferId int64 // ClientTransferId specified by user in PushBatchRequest
+}
+
+// TransferUpdate is published by TransferTracker when the status of a dispatch changes or polling fails
+type TransferUpdate struct {
+	Key      TransferKey    // Key the dispatch was registered with
+	Previous TransferStatus // Previous status of the dispatch, empty on the first poll
+	Transfer *Transfer      // Transfer is the polled dispatch. Transfer.Errors holds dispatch errors on failure. Nil if polling failed
+	Err      error          // Err is the polling error
+}
+
+// TransferTracker polls registered dispatches concurrently until they reach a terminal status
+// (TransferStatusFailed or TransferStatusSent) and publishes status transitions.
+type TransferTracker struct {
+	Client   Client                // Client used to query dispatch statuses
+	Interval time.Duration         // Interval between polls of the same dispatch. Default is 1 minute
+	Workers  int                   // Workers is the number of statuses queried concurrently. Default is 1
+	Limiter  *RateLimiter          // Limiter is the rate budget for status queries. All queries use key 0. Nil means no limit
+	OnUpdate func(*TransferUpdate) // OnUpdate is called for every update, concurrently by Workers. If it is nil, updates are published to Updates channel
+
+	mu      sync.Mutex
+	updates chan *TransferUpdate
+	running bool
+	tracked map[TransferKey]TransferStatus
+}
+
+func NewTransferTracker(client Client, interval time.Duration) *TransferTracker {
+	return &TransferTracker{
+		Client:   client,
+		Interval: interval,
+		tracked:  make(map[TransferKey]TransferStatus),
+	}
+}
+
+// Track is a method to register a dispatch by transfer id
+func (t *TransferTracker) Track(transferId int) {
+	t.add(TransferKey{TransferId: transferId})
+}
+
+// TrackClientTransfer is a method to register a dispatch by group id and client transfer id
+func (t *TransferTracker) TrackClientTransfer(groupId int, clientTransferId int64) {
+	t.add(TransferKey{GroupId: groupId, ClientTransferId: clientTransferId})
+}
+
+// Pending is a method to get the number of dispatches which have not reached a terminal status yet
+func (t *TransferTracker) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.tracked)
+}
+
+// Updates is a channel the updates of the current or the next Run are published to when OnUpdate is not set.
+// It should be read while Run is working, since polling waits when the channel is full.
+// It is closed when Run returns, and the next Run publishes to a new channel.
+func (t *TransferTracker) Updates() <-chan *TransferUpdate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.channel()
+}
+
+// Run is a method to poll registered dispatches every Interval until ctx is done.
+// Dispatches can be registered while Run is working. Run can be called again after it returns,
+// but ErrTrackerRunning is returned if it is already running.
+func (t *TransferTracker) Run(ctx context.Context) error {
+	t.mu.Lock()
+	if t.running {
+		t.mu.Unlock()
+		return ErrTrackerRunning
+	}
+	t.running = true
+	updates := t.channel()
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		close(updates)
+		t.updates = nil
+		t.running = false
+		t.mu.Unlock()
+	}()
+
+	interval := t.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		t.poll(ctx, updates)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// channel returns the updates channel, creating it if needed. t.mu must be held.
+func (t *TransferTracker) channel() chan *TransferUpdate {
+	if t.updates == nil {
+		t.updates = make(chan *TransferUpdate, trackerBuffer)
+	}
+	return t.updates
+}
+
+func (t *TransferTracker) add(key TransferKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.tracked[key]; !ok {
+		t.tracked[key] = ""
+	}
+}
+
+func (t *TransferTracker) poll(ctx context.Context, updates chan<- *TransferUpdate) {
+	t.mu.Lock()
+	keys := make([]TransferKey, 0, len(t.tracked))
+	for k := range t.tracked {
+		keys = append(keys, k)
+	}
+	t.mu.Unlock()
+
+	workers := t.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	jobs := make(chan TransferKey)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				t.check(ctx, key, updates)
+			}
+		}()
+	}
+
+	for _, k := range keys {
+		select {
+		case jobs <- k:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func (t *TransferTracker) check(ctx context.Context, key TransferKey, updates chan<- *TransferUpdate) {
+	if err := t.Limiter.Wait(ctx, 0); err != nil {
+		return
+	}
+
+	var (
+		transfer *Transfer
+		err      error
+	)
+	if key.TransferId != 0 {
+		transfer, err = t.Client.GetStatusByTransferId(key.TransferId)
+	} else {
+		transfer, err = t.Client.GetStatusByClientTransferId(key.GroupId, key.ClientTransferId)
+	}
+	if err == nil && transfer == nil {
+		err = ErrEmptyTransfer
+	}
+	if err != nil {
+		t.publish(ctx, updates, &TransferUpdate{Key: key, Err: err})
+		return
+	}
+
+	t.mu.Lock()
+	previous := t.tracked[key]
+	if transfer.Status.IsTerminal() {
+		delete(t.tracked, key)
+	} else {
+		t.tracked[key] = transfer.Status
+	}
+	t.mu.Unlock()
+
+	if previous != transfer.Status {
+		t.publish(ctx, updates, &TransferUpdate{Key: key, Previous: previous, Transfer: transfer})
+	}
+}
+
+func (t *TransferTracker) publish(ctx context.Context, updates chan<- *TransferUpdate, u *TransferUpdate) {
+	if t.OnUpdate != nil {
+		t.OnUpdate(u)
+		return
+	}
+	select {
+	case updates <- u:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,131 @@
+package appmetrica_push
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// statusAPI is Client which reports every dispatch as pending, in progress and then sent
+type statusAPI struct {
+	Client
+
+	mu    sync.Mutex
+	polls map[int]int
+}
+
+// emptyTransferId is the dispatch statusAPI reports with an empty response
+const emptyTransferId = -1
+
+func (a *statusAPI) GetStatusByTransferId(transferId int) (*Transfer, error) {
+	if transferId == emptyTransferId {
+		return nil, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	statuses := []TransferStatus{TransferStatusPending, TransferStatusInProgress, TransferStatusSent}
+	n := a.polls[transferId]
+	a.polls[transferId]++
+	if n >= len(statuses) {
+		n = len(statuses) - 1
+	}
+	return &Transfer{ID: transferId, Status: statuses[n]}, nil
+}
+
+func (a *statusAPI) GetStatusByClientTransferId(groupId int, clientTransferId int64) (*Transfer, error) {
+	return nil, errors.New("status is not found")
+}
+
+func collectUpdates(t *testing.T, tracker *TransferTracker) []*TransferUpdate {
+	t.Helper()
+	updates := tracker.Updates()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- tracker.Run(ctx)
+	}()
+
+	received := make([]*TransferUpdate, 0)
+	for u := range updates {
+		received = append(received, u)
+		if tracker.Pending() == 0 && u.Transfer != nil && u.Transfer.Status.IsTerminal() {
+			cancel()
+		}
+	}
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run returned %v", err)
+	}
+	return received
+}
+
+func TestTransferTrackerRestart(t *testing.T) {
+	tracker := NewTransferTracker(&statusAPI{polls: make(map[int]int)}, 5*time.Millisecond)
+
+	for run := 0; run < 2; run++ {
+		tracker.Track(run + 1)
+		updates := collectUpdates(t, tracker)
+		if len(updates) != 3 {
+			t.Fatalf("run %d: got %d updates, want pending, in progress and sent", run, len(updates))
+		}
+		if last := updates[2]; last.Previous != TransferStatusInProgress || last.Transfer.Status != TransferStatusSent {
+			t.Fatalf("run %d: unexpected last update %+v", run, last)
+		}
+	}
+}
+
+func TestTransferTrackerRunsOnce(t *testing.T) {
+	tracker := NewTransferTracker(&statusAPI{polls: make(map[int]int)}, time.Hour)
+	tracker.OnUpdate = func(*TransferUpdate) {}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- tracker.Run(ctx)
+		}()
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTrackerRunning) {
+			t.Fatalf("second Run returned %v, want ErrTrackerRunning", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second Run should fail while the first one is running")
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first Run returned %v", err)
+	}
+}
+
+func TestTransferTrackerPollingError(t *testing.T) {
+	tests := []struct {
+		name string
+		key  TransferKey
+		want error
+	}{
+		{"api error", TransferKey{GroupId: 1, ClientTransferId: 42}, nil},
+		{"empty transfer", TransferKey{TransferId: emptyTransferId}, ErrEmptyTransfer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTransferTracker(&statusAPI{polls: make(map[int]int)}, time.Hour)
+			tracker.add(tt.key)
+			updates := tracker.Updates()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go tracker.Run(ctx)
+			u := <-updates
+			cancel()
+			if u.Err == nil || (tt.want != nil && !errors.Is(u.Err, tt.want)) {
+				t.Fatalf("polling error should be published, got %+v", u)
+			}
+			if u.Key != tt.key || tracker.Pending() != 1 {
+				t.Fatalf("dispatch %+v should be kept, got %+v", tt.key, u)
+			}
+		})
+	}
+}
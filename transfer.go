@@ -0,0 +1,46 @@
+package appmetrica_push
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// creationDateLayouts are the formats Transfer.CreationDate is parsed with, in order
+var creationDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// IsTerminal reports whether the dispatch will not change its status anymore
+func (s TransferStatus) IsTerminal() bool {
+	return s == TransferStatusFailed || s == TransferStatusSent
+}
+
+// IsSuccess reports whether the dispatch was sent
+func (s TransferStatus) IsSuccess() bool {
+	return s == TransferStatusSent
+}
+
+func (s TransferStatus) String() string {
+	return string(s)
+}
+
+func (t *Transfer) UnmarshalJSON(data []byte) error {
+	type transfer Transfer
+	if err := json.Unmarshal(data, (*transfer)(t)); err != nil {
+		return err
+	}
+	t.CreatedAt = parseCreationDate(t.CreationDate)
+	return nil
+}
+
+func parseCreationDate(s string) time.Time {
+	for _, layout := range creationDateLayouts {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d
+		}
+	}
+	return time.Time{}
+}
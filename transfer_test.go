@@ -0,0 +1,70 @@
+package appmetrica_push
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTransferStatus(t *testing.T) {
+	tests := []struct {
+		status   TransferStatus
+		terminal bool
+		success  bool
+	}{
+		{TransferStatusPending, false, false},
+		{TransferStatusInProgress, false, false},
+		{TransferStatusSent, true, true},
+		{TransferStatusFailed, true, false},
+		{"paused", false, false},
+	}
+	for _, tt := range tests {
+		var transfer Transfer
+		if err := json.Unmarshal([]byte(`{"id":1,"status":"`+string(tt.status)+`"}`), &transfer); err != nil {
+			t.Fatal(err)
+		}
+		if transfer.Status != tt.status || transfer.Status.String() != string(tt.status) {
+			t.Errorf("%s: parsed as %q", tt.status, transfer.Status)
+		}
+		if transfer.Status.IsTerminal() != tt.terminal || transfer.Status.IsSuccess() != tt.success {
+			t.Errorf("%s: terminal %v, success %v", tt.status, transfer.Status.IsTerminal(), transfer.Status.IsSuccess())
+		}
+	}
+}
+
+func TestTransferCreationDate(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"2026-03-01T10:20:30.5+03:00", time.Date(2026, 3, 1, 7, 20, 30, 500000000, time.UTC)},
+		{"2026-03-01T10:20:30", time.Date(2026, 3, 1, 10, 20, 30, 0, time.UTC)},
+		{"2026-03-01 10:20:30", time.Date(2026, 3, 1, 10, 20, 30, 0, time.UTC)},
+		{"2026-03-01", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"01.03.2026", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		raw, _ := json.Marshal(tt.raw)
+		var transfer Transfer
+		if err := json.Unmarshal([]byte(`{"id":1,"creation_date":`+string(raw)+`}`), &transfer); err != nil {
+			t.Fatal(err)
+		}
+		if !transfer.CreatedAt.Equal(tt.want) {
+			t.Errorf("%q: parsed as %s, want %s", tt.raw, transfer.CreatedAt, tt.want)
+		}
+
+		// the raw value is kept as is, so marshalling gives back what the API returned
+		data, err := json.Marshal(&transfer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again Transfer
+		if err := json.Unmarshal(data, &again); err != nil {
+			t.Fatal(err)
+		}
+		if again.CreationDate != tt.raw || !again.CreatedAt.Equal(transfer.CreatedAt) {
+			t.Errorf("%q: round trip gives %q parsed as %s", tt.raw, again.CreationDate, again.CreatedAt)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package appmetrica_push
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// URLInfo is metadata of a file available by URL
+type URLInfo struct {
+	StatusCode    int    // StatusCode of the response
+	ContentType   string // ContentType is the media type without parameters, e.g. image/png. Empty if unknown
+	ContentLength int64  // ContentLength in bytes, -1 if unknown
+}
+
+// URLChecker requests metadata of files by URL. Implement it to check URLs without network, e.g. in tests.
+type URLChecker interface {
+	Head(ctx context.Context, url string) (*URLInfo, error)
+}
+
+// URLOpener is implemented by checkers which can download the file. It lets checks look into the file,
+// e.g. to read dimensions of images. The caller closes the body.
+type URLOpener interface {
+	Open(ctx context.Context, url string) (*URLInfo, io.ReadCloser, error)
+}
+
+// HTTPURLChecker is URLChecker which sends HEAD requests. It implements URLOpener with GET requests.
+type HTTPURLChecker struct {
+	Client *http.Client // Client used to send requests
+}
+
+// NewHTTPURLChecker is a function to create checker with the given client. Nil client means http.DefaultClient
+func NewHTTPURLChecker(httpClient *http.Client) *HTTPURLChecker {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &HTTPURLChecker{Client: httpClient}
+}
+
+func (c *HTTPURLChecker) Head(ctx context.Context, url string) (*URLInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return &URLInfo{
+		StatusCode:    resp.StatusCode,
+		ContentType:   mediaType(resp.Header.Get("Content-Type")),
+		ContentLength: resp.ContentLength,
+	}, nil
+}
+
+func (c *HTTPURLChecker) Open(ctx context.Context, url string) (*URLInfo, io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &URLInfo{
+		StatusCode:    resp.StatusCode,
+		ContentType:   mediaType(resp.Header.Get("Content-Type")),
+		ContentLength: resp.ContentLength,
+	}
+	return info, resp.Body, nil
+}
+
+// checkReachable returns an error if the file can't be downloaded
+func checkReachable(info *URLInfo) error {
+	if info.StatusCode < 200 || info.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", info.StatusCode)
+	}
+	return nil
+}
+
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return t
+}